@@ -0,0 +1,265 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "goCache/gocache/gocachepb"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+/*
+	节点熔断
+	每个远程节点对应一个熔断器，统计最近若干次请求的错误率和耗时:
+	  - closed: 正常放行 错误率超过阈值后打开
+	  - open: 拒绝请求 PickPeer会跳过该节点 经过OpenTimeout后进入半开状态
+	  - half-open: 只放行少量探测请求 全部成功后关闭 任意一次失败重新打开
+*/
+
+// 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// 熔断器打开时拒绝请求返回的错误
+var ErrPeerEjected = errors.New("gocache: peer ejected by circuit breaker")
+
+// 熔断器配置
+type BreakerConfig struct {
+	// 统计最近多少次请求
+	Window int
+	// 窗口内的请求数量达到该值后才计算错误率
+	MinRequests int
+	// 错误率阈值 达到后打开熔断器
+	ErrorRate float64
+	// 耗时超过该值的请求也计为失败 0表示不判断耗时
+	SlowThreshold time.Duration
+	// 打开后经过多久进入半开状态
+	OpenTimeout time.Duration
+	// 半开状态下放行的探测请求数量
+	HalfOpenRequests int
+}
+
+// 默认的熔断器配置
+var DefaultBreakerConfig = BreakerConfig{
+	Window:           20,
+	MinRequests:      5,
+	ErrorRate:        0.5,
+	OpenTimeout:      5 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+// 熔断器的统计信息
+type BreakerStats struct {
+	State BreakerState
+	// 当前窗口内的请求数和失败数
+	Requests int
+	Failures int
+	// 被拒绝的请求数
+	Rejected int64
+	// 打开的次数
+	Trips int64
+}
+
+type circuitBreaker struct {
+	mu    sync.Mutex
+	cfg   BreakerConfig
+	state BreakerState
+	// 最近请求的结果 环形缓冲区 true表示失败
+	results  []bool
+	next     int
+	count    int
+	failures int
+	// 进入open状态的时间
+	openedAt time.Time
+	// 半开状态下已放行和已成功的探测请求数
+	probes    int
+	successes int
+	rejected  int64
+	trips     int64
+	// 获取当前时间 便于测试
+	now func() time.Time
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultBreakerConfig.Window
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	return &circuitBreaker{
+		cfg:     cfg,
+		results: make([]bool, cfg.Window),
+		now:     time.Now,
+	}
+}
+
+// 判断请求是否可以放行
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			b.rejected++
+			return false
+		}
+		b.state, b.probes, b.successes = BreakerHalfOpen, 0, 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			b.rejected++
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// 判断节点是否被剔除 不会改变状态 用于选择节点
+func (b *circuitBreaker) ejected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return b.now().Sub(b.openedAt) < b.cfg.OpenTimeout
+	case BreakerHalfOpen:
+		return b.probes >= b.cfg.HalfOpenRequests
+	}
+	return false
+}
+
+// 记录一次请求的结果
+func (b *circuitBreaker) record(err error, latency time.Duration) {
+	// 数据源中不存在不是节点的问题
+	failed := err != nil && !errors.Is(err, ErrNotFound)
+	if b.cfg.SlowThreshold > 0 && latency > b.cfg.SlowThreshold {
+		failed = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.trip()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.reset()
+		}
+		return
+	case BreakerOpen:
+		// 打开之前发出的请求 结果不再统计
+		return
+	}
+	if b.count == len(b.results) {
+		if b.results[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.results[b.next] = failed
+	b.next = (b.next + 1) % len(b.results)
+	if failed {
+		b.failures++
+	}
+	if b.count >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.ErrorRate*float64(b.count) && b.failures > 0 {
+		b.trip()
+	}
+}
+
+// 放行的请求没有结果时调用 归还半开状态下占用的探测名额
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// 打开熔断器
+func (b *circuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.trips++
+}
+
+// 关闭熔断器并清空统计窗口
+func (b *circuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.next, b.count, b.failures = 0, 0, 0
+}
+
+func (b *circuitBreaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state
+	if state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		state = BreakerHalfOpen
+	}
+	return BreakerStats{
+		State:    state,
+		Requests: b.count,
+		Failures: b.failures,
+		Rejected: b.rejected,
+		Trips:    b.trips,
+	}
+}
+
+// 带熔断器的PeerGetter
+type breakerPeer struct {
+	getter  PeerGetter
+	breaker *circuitBreaker
+	// 正在进行中的请求数 用于有界负载
+	inflight AtomicInt
+}
+
+func (p *breakerPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	if !p.breaker.allow() {
+		return ErrPeerEjected
+	}
+	p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	start := time.Now()
+	err := p.getter.Get(ctx, in, out)
+	if errors.Is(ctx.Err(), context.Canceled) || errorCode(err) == codes.Canceled {
+		// 调用方取消的请求(例如对冲请求先返回)不是节点的问题 不计入统计
+		// 超时仍然计为失败 否则无响应的节点永远不会被剔除
+		p.breaker.release()
+		return err
+	}
+	p.breaker.record(err, time.Since(start))
+	return err
+}
+
+// owner被剔除时 发给后继节点的请求按故障转移处理 后继节点不再转发给owner
+type failoverPeer struct {
+	PeerGetter
+}
+
+func (p failoverPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	in.Failover = true
+	return p.PeerGetter.Get(ctx, in, out)
+}
@@ -0,0 +1,226 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "goCache/gocache/gocachepb"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 创建一个使用可控时钟的熔断器
+func newTestBreaker(cfg BreakerConfig) (*circuitBreaker, *time.Time) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(cfg)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b, now := newTestBreaker(BreakerConfig{
+		Window:           4,
+		MinRequests:      4,
+		ErrorRate:        0.5,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 1,
+	})
+	fake := &fakePeer{value: "630"}
+	peer := &breakerPeer{getter: fake, breaker: b}
+	get := func() error {
+		return peer.Get(context.Background(), &pb.Request{}, &pb.Response{})
+	}
+
+	// 窗口内一半的请求失败后打开
+	for i := 0; i < 2; i++ {
+		get()
+	}
+	fake.err = errors.New("unavailable")
+	get()
+	if b.stats().State != BreakerClosed {
+		t.Fatalf("breaker should stay closed before MinRequests")
+	}
+	get()
+	if s := b.stats(); s.State != BreakerOpen || s.Trips != 1 {
+		t.Fatalf("breaker should open at 50%% errors, got %+v", s)
+	}
+
+	// 打开状态下拒绝请求 不会访问节点
+	calls := fake.calls.Get()
+	if err := get(); !errors.Is(err, ErrPeerEjected) || fake.calls.Get() != calls || !b.ejected() {
+		t.Fatalf("open breaker should reject requests, got %v", err)
+	}
+
+	// 超时后进入半开状态 探测失败重新打开
+	*now = now.Add(time.Second)
+	if b.ejected() {
+		t.Fatalf("breaker should allow a probe after OpenTimeout")
+	}
+	get()
+	if s := b.stats(); s.State != BreakerOpen || s.Trips != 2 {
+		t.Fatalf("failed probe should reopen breaker, got %+v", s)
+	}
+
+	// 探测成功后关闭
+	*now = now.Add(time.Second)
+	fake.err = nil
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.stats(); s.State != BreakerClosed || s.Requests != 0 || s.Rejected != 1 {
+		t.Fatalf("successful probe should close breaker, got %+v", s)
+	}
+
+	// NOT_FOUND不计为失败
+	fake.err = ErrNotFound
+	for i := 0; i < 4; i++ {
+		get()
+	}
+	if s := b.stats(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Fatalf("not found should not count as failure, got %+v", s)
+	}
+}
+
+// 耗时超过阈值的请求计为失败
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{
+		Window:        2,
+		MinRequests:   2,
+		ErrorRate:     1,
+		SlowThreshold: 10 * time.Millisecond,
+		OpenTimeout:   time.Second,
+	})
+	b.record(nil, 20*time.Millisecond)
+	b.record(nil, time.Millisecond)
+	if b.stats().State != BreakerClosed {
+		t.Fatalf("one slow call in two should not open breaker")
+	}
+	b.record(nil, 20*time.Millisecond)
+	b.record(nil, 30*time.Millisecond)
+	if b.stats().State != BreakerOpen {
+		t.Fatalf("slow calls should open breaker")
+	}
+}
+
+// PickPeer跳过被剔除的owner
+func TestServer_PickPeerSkipsEjected(t *testing.T) {
+	svr, _ := NewServer("a:1", WithBreaker(BreakerConfig{Window: 1, MinRequests: 1, OpenTimeout: time.Minute}))
+	fakes := map[string]*fakePeer{}
+	svr.newGetter = func(peer string) PeerGetter {
+		fakes[peer] = &fakePeer{value: peer}
+		return fakes[peer]
+	}
+	svr.Set("a:1", "b:1", "c:1")
+
+	// 找一个owner是b 下一个节点是c的key
+	var key string
+	for i := 0; ; i++ {
+		key = string(rune('a'+i%26)) + string(rune('0'+i/26))
+		if nodes := svr.peers.GetN(key, 2); nodes[0] == "b:1" && nodes[1] == "c:1" {
+			break
+		}
+	}
+	peer, ok := svr.PickPeer(key)
+	if !ok || peer != PeerGetter(svr.clients["b:1"]) {
+		t.Fatalf("owner b should be picked")
+	}
+	fakes["b:1"].err = errors.New("unavailable")
+	peer.Get(context.Background(), &pb.Request{}, &pb.Response{})
+	if svr.PeerStats()["b:1"].State != BreakerOpen {
+		t.Fatalf("b should be ejected, stats %+v", svr.PeerStats())
+	}
+
+	peer, ok = svr.PickPeer(key)
+	if !ok {
+		t.Fatalf("successor c should be picked")
+	}
+	in := &pb.Request{}
+	out := &pb.Response{}
+	if err := peer.Get(context.Background(), in, out); err != nil || string(out.Value) != "c:1" || !in.Failover {
+		t.Fatalf("request should go to c as failover, got %q %v", out.Value, err)
+	}
+}
+
+// 对冲请求先返回后被取消的owner请求不计为失败
+func TestCircuitBreakerHedgeCancel(t *testing.T) {
+	b, now := newTestBreaker(BreakerConfig{Window: 1, MinRequests: 1, ErrorRate: 1, OpenTimeout: time.Second})
+	slow := &fakePeer{value: "owner", delay: time.Second}
+	owner := &breakerPeer{getter: slow, breaker: b}
+	g := NewGroup("hedging-breaker", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithHedging(HedgingConfig{Percentile: 0.95, MaxDelay: 10 * time.Millisecond}))
+	g.RegisterPeers(&fakePicker{owner: owner, replicas: []PeerGetter{&fakePeer{value: "successor"}}})
+
+	for i := 0; i < 3; i++ {
+		if view, err := g.Get(fmt.Sprintf("k%d", i)); err != nil || view.String() != "successor" {
+			t.Fatalf("hedged request should win, got %q %v", view.String(), err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for slow.canceled.Get() != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := b.stats(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Fatalf("cancelled requests should not trip breaker, got %+v", s)
+	}
+
+	// 半开状态下被取消的探测请求归还名额
+	b.record(errors.New("unavailable"), 0)
+	*now = now.Add(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	owner.Get(ctx, &pb.Request{}, &pb.Response{})
+	if b.ejected() {
+		t.Fatalf("cancelled probe should release its slot")
+	}
+}
+
+// 超过AttemptTimeout没有响应的节点计为失败 熔断器打开
+func TestCircuitBreakerTimeout(t *testing.T) {
+	b, _ := newTestBreaker(BreakerConfig{Window: 5, MinRequests: 5, ErrorRate: 0.5, OpenTimeout: time.Minute})
+	owner := &breakerPeer{getter: &fakePeer{hang: true}, breaker: b}
+	g := NewGroup("breaker-timeout", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithFailover(FailoverConfig{Replicas: 1, AttemptTimeout: 10 * time.Millisecond}))
+	g.RegisterPeers(&fakePicker{owner: owner, replicas: []PeerGetter{&fakePeer{value: "replica"}}})
+
+	for i := 0; i < 5; i++ {
+		if view, err := g.Get(fmt.Sprintf("k%d", i)); err != nil || view.String() != "replica" {
+			t.Fatalf("should fail over to replica, got %q %v", view.String(), err)
+		}
+	}
+	if s := b.stats(); s.State != BreakerOpen || s.Failures != 5 {
+		t.Fatalf("timed out calls should open breaker, got %+v", s)
+	}
+}
+
+// owner被剔除后选择了自身时 只加载不写入mainCache
+func TestServer_PickPeerSelfNotOwner(t *testing.T) {
+	svr, _ := NewServer("a:1", WithBreaker(BreakerConfig{Window: 1, MinRequests: 1, OpenTimeout: time.Minute}))
+	svr.newGetter = func(peer string) PeerGetter { return &fakePeer{err: errors.New("unavailable")} }
+	svr.Set("a:1", "b:1")
+	var key string
+	for i := 0; ; i++ {
+		key = strconv.Itoa(i)
+		if svr.peers.Get(key) == "b:1" {
+			break
+		}
+	}
+	svr.clients["b:1"].breaker.trip()
+	if _, ok := svr.PickPeer(key); ok {
+		t.Fatalf("self should be the next candidate")
+	}
+	g := NewGroup("pick-self", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(svr)
+	if view, err := g.Get(key); err != nil || view.String() != "local" {
+		t.Fatalf("should load locally, got %q %v", view.String(), err)
+	}
+	if g.mainCache.contains(key) || g.Stats.FallbackLoads.Get() != 1 {
+		t.Fatalf("key owned by b should not be cached on a")
+	}
+}
@@ -1,24 +1,175 @@
 package gocache
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	pb "goCache/gocache/gocachepb"
+)
+
 // 表示缓存值
 
 type ByteView struct{
-	// 支持任意数据类型的存储
+	// 支持任意数据类型的存储 b和s只会使用其中一个 b为nil时使用s
 	b []byte
+	s string
+	// b的压缩算法 只在缓存内部和节点之间传输时使用 返回给调用方的值总是未压缩的
+	c pb.Compression
+	// 过期时间 零值表示永不过期
+	e time.Time
+	// 版本号 加载开始或者写入时生成 单调递增 0表示未知
+	ver uint64
+	// 从其他节点获取时 本地开始请求时的序号 只在当前节点有效 用于和墓碑比较 0表示使用ver
+	seq uint64
+	// 标签 InvalidateTag时删除带有该标签的值
+	tags []string
+}
+// 使用字符串创建一个只读的缓存值 不会复制数据
+func StringView(s string) ByteView{
+	return ByteView{s: s}
+}
+// 返回缓存值的过期时间 零值表示永不过期
+func (v ByteView)Expire() time.Time{
+	return v.e
 }
-//实现需要的函数 在lru cache中定义了value接口需要实现Len函数 
+// 判断在now时刻是否还没有过期
+func (v ByteView)fresh(now time.Time) bool{
+	return v.e.IsZero() || now.Before(v.e)
+}
+//实现需要的函数 在lru cache中定义了value接口需要实现Len函数
 func (v ByteView)Len() int{
-	return len(v.b)
+	if v.b != nil{
+		return len(v.b)
+	}
+	return len(v.s)
 }
-// 复制缓存为一个byte切片 
+// 复制缓存为一个byte切片
 func (v ByteView)ByteSlice() []byte{
-	return cloneBytes(v.b)
+	if v.b != nil{
+		return cloneBytes(v.b)
+	}
+	return []byte(v.s)
 }
 // 转化为string
 func (v ByteView)String() string{
-	return string(v.b)
+	if v.b != nil{
+		return string(v.b)
+	}
+	return v.s
+}
+// 返回第i个字节
+func (v ByteView)At(i int) byte{
+	if v.b != nil{
+		return v.b[i]
+	}
+	return v.s[i]
+}
+// 返回[from,to)之间的视图 不会复制数据
+func (v ByteView)Slice(from, to int) ByteView{
+	if v.b != nil{
+		return ByteView{b: v.b[from:to]}
+	}
+	return ByteView{s: v.s[from:to]}
+}
+// 返回从from开始的视图 不会复制数据
+func (v ByteView)SliceFrom(from int) ByteView{
+	if v.b != nil{
+		return ByteView{b: v.b[from:]}
+	}
+	return ByteView{s: v.s[from:]}
+}
+// 将数据复制到dest中 返回复制的字节数
+func (v ByteView)Copy(dest []byte) int{
+	if v.b != nil{
+		return copy(dest, v.b)
+	}
+	return copy(dest, v.s)
+}
+// 判断两个缓存值的内容是否相同
+func (v ByteView)Equal(b2 ByteView) bool{
+	if b2.b == nil{
+		return v.EqualString(b2.s)
+	}
+	return v.EqualBytes(b2.b)
+}
+// 判断内容是否和字符串s相同
+func (v ByteView)EqualString(s string) bool{
+	if v.b == nil{
+		return v.s == s
+	}
+	l := v.Len()
+	if len(s) != l{
+		return false
+	}
+	for i, bi := range v.b{
+		if bi != s[i]{
+			return false
+		}
+	}
+	return true
+}
+// 判断内容是否和b2相同
+func (v ByteView)EqualBytes(b2 []byte) bool{
+	if v.b != nil{
+		return bytes.Equal(v.b, b2)
+	}
+	l := v.Len()
+	if len(b2) != l{
+		return false
+	}
+	for i, bi := range b2{
+		if bi != v.s[i]{
+			return false
+		}
+	}
+	return true
+}
+// 返回一个读取缓存值的io.ReadSeeker 不会复制数据
+func (v ByteView)Reader() io.ReadSeeker{
+	if v.b != nil{
+		return bytes.NewReader(v.b)
+	}
+	return strings.NewReader(v.s)
+}
+// 实现io.ReaderAt
+func (v ByteView)ReadAt(p []byte, off int64) (n int, err error){
+	if off < 0{
+		return 0, errors.New("view: invalid offset")
+	}
+	if off >= int64(v.Len()){
+		return 0, io.EOF
+	}
+	n = v.SliceFrom(int(off)).Copy(p)
+	if n < len(p){
+		err = io.EOF
+	}
+	return
+}
+// 实现io.WriterTo 直接将数据写入w 不会复制数据
+func (v ByteView)WriteTo(w io.Writer) (n int64, err error){
+	var m int
+	if v.b != nil{
+		m, err = w.Write(v.b)
+	}else{
+		m, err = io.WriteString(w, v.s)
+	}
+	if err == nil && m < v.Len(){
+		err = io.ErrShortWrite
+	}
+	n = int64(m)
+	return
+}
+// 返回底层数据 不会复制 调用方不能修改返回的切片
+func (v ByteView)bytes() []byte{
+	if v.b != nil{
+		return v.b
+	}
+	return []byte(v.s)
 }
-// b是只读的 防止被修改 
+// b是只读的 防止被修改
 func cloneBytes(b []byte)[]byte{
 	c := make([]byte,len(b))
 	copy(c,b)
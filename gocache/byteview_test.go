@@ -0,0 +1,44 @@
+package gocache
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// 测试字节和字符串两种形式的缓存值行为一致
+func TestByteView(t *testing.T) {
+	const s = "gocache byteview"
+	for name, v := range map[string]ByteView{
+		"bytes":  {b: []byte(s)},
+		"string": StringView(s),
+	} {
+		if v.Len() != len(s) || v.String() != s || v.At(2) != s[2] {
+			t.Errorf("%s: basic accessors failed", name)
+		}
+		if got := v.Slice(2, 7).String(); got != s[2:7] {
+			t.Errorf("%s: Slice = %q, want %q", name, got, s[2:7])
+		}
+		if got := v.SliceFrom(8).String(); got != s[8:] {
+			t.Errorf("%s: SliceFrom = %q, want %q", name, got, s[8:])
+		}
+		dest := make([]byte, 4)
+		if n := v.Copy(dest); n != 4 || string(dest) != s[:4] {
+			t.Errorf("%s: Copy = %q", name, dest)
+		}
+		if !v.Equal(StringView(s)) || !v.EqualBytes([]byte(s)) || v.EqualString(s+"!") {
+			t.Errorf("%s: Equal failed", name)
+		}
+		r := v.Reader()
+		if _, err := r.Seek(8, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != s[8:] {
+			t.Errorf("%s: Reader after Seek = %q", name, rest)
+		}
+		var buf bytes.Buffer
+		if n, err := v.WriteTo(&buf); err != nil || n != int64(len(s)) || buf.String() != s {
+			t.Errorf("%s: WriteTo = %q, %v", name, buf.String(), err)
+		}
+	}
+}
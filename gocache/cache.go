@@ -9,26 +9,271 @@ package gocache
 import (
 	// "goCache/lru"
 	"goCache/gocache/lru"
+	"strings"
 	"sync"
+	"time"
 )
 
 // 封装一层lru中的cache 从而实现支持并发读写 并封装add和get方法
+// 同时维护按key排序和按标签的二级索引 lru淘汰、删除或者替换key时通过OnEvictedReason清理
 type  cache struct{
 	mu sync.Mutex
 	lru *lru.Cache
 	cacheBytes int64
+	// 每个条目除了key和value之外额外计算的字节数
+	entryOverhead int64
+	// 按key排序的索引 用于按前缀删除
+	sorted *keyIndex
+	// 标签到key的索引 用于按标签删除
+	tagged map[string]map[string]struct{}
+	// 值被移除时的回调函数 在释放锁之后调用
+	onEvict func(key string, value ByteView, reason EvictReason)
+	// 持有锁期间被移除的值
+	pending []evictEvent
+}
+
+// 释放锁之后再调用回调函数 回调函数中可以访问缓存
+func (c *cache) unlock() {
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	for _, e := range pending {
+		c.onEvict(e.key, e.value, e.reason)
+	}
+}
+
+// 延迟初始化 调用时需要持有锁
+func (c *cache) init() {
+	if c.lru == nil{
+		// 如果当前缓存为空则new一个 延迟初始化 提高性能 减少要求 
+		c.lru = lru.New(c.cacheBytes, nil)
+		c.lru.OnEvictedReason = c.onEvicted
+		c.lru.SetEntryOverhead(c.entryOverhead)
+		c.sorted = newKeyIndex()
+		c.tagged = map[string]map[string]struct{}{}
+	}
+}
+
+// lru淘汰、删除或者替换key时清理索引 lru在持有锁时调用 替换时value是旧值
+func (c *cache) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	v := value.(ByteView)
+	c.unindex(key, v)
+	if c.onEvict != nil {
+		// 过期的值被重新加载的值替换
+		if reason == lru.EvictReplaced && !v.fresh(time.Now()) {
+			reason = lru.EvictExpired
+		}
+		c.pending = append(c.pending, evictEvent{key, v, reason})
+	}
+}
+
+func (c *cache) index(key string, value ByteView) {
+	c.sorted.insert(key)
+	for _, tag := range value.tags {
+		keys, ok := c.tagged[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			c.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (c *cache) unindex(key string, value ByteView) {
+	c.sorted.delete(key)
+	for _, tag := range value.tags {
+		if keys, ok := c.tagged[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(c.tagged, tag)
+			}
+		}
+	}
+}
+
+// 写入key 旧值的索引在替换时清理 值太大被立即淘汰时不建立索引 调用时需要持有锁
+func (c *cache) put(key string, value ByteView) {
+	c.lru.Add(key, value)
+	if c.lru.Contains(key) {
+		c.index(key, value)
+	}
 }
 
 func (c *cache)add(key string,value ByteView){
 	// 上锁 
+	c.mu.Lock()
+	defer c.unlock()
+	c.init()
+	// 然后添加缓存 
+	c.put(key, value)
+}
+
+// 由admit根据缓存中已有的值决定是否添加 返回是否添加
+// 判断和添加在同一次加锁中完成 失效时先记录墓碑再删除 所以不会有旧值在两者之间写入
+func (c *cache) addIf(key string, value ByteView, admit func(old ByteView, ok bool) bool) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	c.init()
+	var old ByteView
+	v, ok := c.lru.Peek(key)
+	if ok {
+		old = v.(ByteView)
+	}
+	if !admit(old, ok) {
+		return false
+	}
+	c.put(key, value)
+	return true
+}
+
+// 返回包括额外开销在内的内存占用
+func (c *cache) memoryUsage() int64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil{
-		// 如果当前缓存为空则new一个 延迟初始化 提高性能 减少要求 
-		c.lru = lru.New(c.cacheBytes,nil) 
+	if c.lru == nil {
+		return 0
 	}
-	// 然后添加缓存 
-	c.lru.Add(key,value)
+	return c.lru.MemoryUsage()
+}
+
+// 查找但不改变访问顺序
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	if v, ok := c.lru.Peek(key); ok {
+		return v.(ByteView), true
+	}
+	return
+}
+
+// 判断key是否存在 不改变访问顺序
+func (c *cache) contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru != nil && c.lru.Contains(key)
+}
+
+// 删除所有缓存
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.lru != nil {
+		c.lru.Clear()
+	}
+}
+
+// 修改最大内存 超过新的容量时淘汰最久未访问的缓存
+func (c *cache) resize(cacheBytes int64) {
+	c.mu.Lock()
+	defer c.unlock()
+	c.cacheBytes = cacheBytes
+	if c.lru != nil {
+		c.lru.Resize(cacheBytes)
+	}
+}
+
+// 删除key
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.lru == nil {
+		return false
+	}
+	return c.lru.Remove(key)
+}
+
+// 删除所有以prefix开头的key 返回删除的数量
+func (c *cache) removePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.lru == nil {
+		return 0
+	}
+	var keys []string
+	c.sorted.ascend(prefix, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		c.lru.Remove(key)
+	}
+	return len(keys)
+}
+
+// 删除所有带有tag标签的key 返回删除的数量
+func (c *cache) removeTag(tag string) int {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.lru == nil {
+		return 0
+	}
+	keys := make([]string, 0, len(c.tagged[tag]))
+	for key := range c.tagged[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		c.lru.Remove(key)
+	}
+	return len(keys)
+}
+
+// 按key的字典序返回以prefix开头并且大于cursor的最多limit个值 limit<=0表示不限制
+// 通过有序索引查找 只在复制这一页时持有锁 不改变访问顺序
+// 还有更多的key时next为本页最后一个key 否则为空字符串
+func (c *cache) scan(prefix, cursor string, limit int) (keys []string, values []ByteView, next string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	from := prefix
+	if cursor >= from {
+		// 从cursor之后的第一个key开始
+		from = cursor + "\x00"
+	}
+	more := false
+	c.sorted.ascend(from, func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		if limit > 0 && len(keys) == limit {
+			more = true
+			return false
+		}
+		v, _ := c.lru.Peek(key)
+		keys = append(keys, key)
+		values = append(values, v.(ByteView))
+		return true
+	})
+	if more {
+		next = keys[len(keys)-1]
+	}
+	return
+}
+
+// 按从最久未访问到最近访问的顺序返回所有缓存值 按该顺序重新添加可以恢复访问顺序
+func (c *cache) entries() (keys []string, values []ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru == nil {
+		return
+	}
+	c.lru.Range(func(key string, value lru.Value) bool {
+		keys = append(keys, key)
+		values = append(values, value.(ByteView))
+		return true
+	})
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+		values[i], values[j] = values[j], values[i]
+	}
+	return
 }
 
 func(c *cache)get(key string)(value ByteView,ok bool){
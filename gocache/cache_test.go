@@ -0,0 +1,23 @@
+package gocache
+
+import "testing"
+
+// 清空和缩小容量时同时清理索引
+func TestCacheClearResize(t *testing.T) {
+	c := cache{}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.add(key, ByteView{s: "123", tags: []string{"t"}})
+	}
+	if v, ok := c.peek("a"); !ok || v.String() != "123" || !c.contains("d") {
+		t.Fatalf("peek failed")
+	}
+	// peek不改变访问顺序 a仍然最先被淘汰
+	c.resize(8)
+	if c.contains("a") || !c.contains("d") || c.sorted.len != 2 || len(c.tagged["t"]) != 2 {
+		t.Fatalf("resize should evict the oldest keys and their index entries")
+	}
+	c.clear()
+	if c.contains("d") || c.sorted.len != 0 || len(c.tagged) != 0 {
+		t.Fatalf("clear should remove all keys and index entries")
+	}
+}
@@ -1,61 +1,264 @@
 package gocache
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"goCache/gocache/etcdregistry"
 	pb "goCache/gocache/gocachepb"
+	"io"
 	"log"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
-		"google.golang.org/protobuf/proto"
-	// "google.golang.org/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// 访问其他节点的默认超时时间
+const defaultPeerTimeout = 10*time.Second
+
 //实现grpc客户端
 type Client struct{
 	// 名称
 	name string 
+	// 建立grpc连接时的额外配置 例如最大消息大小
+	opts []grpc.DialOption
+	// 失败时的重试策略 默认不重试
+	retry RetryPolicy
 }
 
-// 从远程节点获取对应缓存值 
-func (c *Client) Get(in *pb.Request, out *pb.Response)(error){
-	// 先根据group和key获取到对应的访问路径 
-	
+// 设置失败时的重试策略
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
+// 通过etcd获取服务地址并建立grpc连接 返回的close函数用于关闭连接
+func (c *Client) dial(ctx context.Context) (*grpc.ClientConn, func(), error){
 	// 创建一个etcd客户端 
 	cli,err := clientv3.New(defaultEtcdConfig)
-	// log.Println("this is client.go get func ")
 	if err != nil{
-		log.Fatalf("connect etcd  error ! ")
+		return nil, nil, fmt.Errorf("connect etcd error: %v", err)
+	}
+	conn,err := etcdregistry.EtcdDialContext(ctx,cli,c.name,c.opts...)
+	if err != nil{
+		cli.Close()
+		// 连接失败按节点不可用处理 可以重试
+		if ctx.Err() == nil{
+			err = status.Errorf(codes.Unavailable, "dial %s: %v", c.name, err)
+		}
+		return nil, nil, err
+	}
+	return conn, func(){
+		conn.Close()
+		cli.Close()
+	}, nil
+}
+
+// 从远程节点获取对应缓存值 
+// 数据源中不存在时返回包装了ErrNotFound的错误 其他失败返回*PeerError
+func (c *Client) Get(ctx context.Context, in *pb.Request, out *pb.Response)(error){
+	// 调用方没有设置超时时间时 为grpc远程调用设置默认的超时时间
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	in.WireVersion = wireVersion
+	attempts, err := c.retry.do(ctx, func() error{
+		return c.get(ctx, in, out)
+	})
+	if err == nil || errors.Is(err, ErrNotFound){
+		return err
+	}
+	return &PeerError{
+		Peer:     c.name,
+		Group:    in.Group,
+		Key:      in.Key,
+		Code:     errorCode(err),
+		Attempts: attempts,
+		Err:      err,
 	}
-	defer cli.Close()
-	// fmt.Println(cli)
-	fmt.Println("this is client get "+c.name)
-	conn,err := etcdregistry.EtcdDial(cli,c.name)
-	log.Println("this is client.go get func ")
+}
+
+// 请求一次远程节点
+func (c *Client) get(ctx context.Context, in *pb.Request, out *pb.Response) error{
+	// 先根据group和key获取到对应的访问路径 
+	conn,closeConn,err := c.dial(ctx)
 	if err != nil{
 		return err
 	}
-	defer conn.Close()
+	defer closeConn()
 	grpcClient := pb.NewGroupCacheClient(conn)
 
-	// 为grpc远程调用设置超时时间 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 	resp, err := grpcClient.Get(ctx, in)
 	// log.Println("this is client.go get funcs ")
+	if status.Code(err) == codes.ResourceExhausted{
+		// 值超过了单个消息的大小限制 改为分块获取
+		log.Printf("value of %s/%s is too large, fall back to stream", in.Group, in.Key)
+		return c.getStream(ctx, grpcClient, in, out)
+	}
 	if err != nil{
-		return fmt.Errorf("can not get %s/%s from peer %s", in.Group,in.Key, c.name)
+		return err
 	}
-	if err = proto.Unmarshal(resp.GetValue(), out); err != nil {
-		return fmt.Errorf("decoding response body:%v", err)
+	return decodeResponse(in, resp, out)
+}
+// 分块获取大值 并组装到out中
+func (c *Client) GetStream(ctx context.Context, in *pb.Request, out *pb.Response) error{
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	conn,closeConn,err := c.dial(ctx)
+	if err != nil{
+		return err
+	}
+	defer closeConn()
+	return c.getStream(ctx, pb.NewGroupCacheClient(conn), in, out)
+}
+
+// 分块获取值并直接写入w 不在内存中组装完整的值
+// 写入的是传输时的形式 返回值为对应的压缩算法
+// 大值的传输时间和大小相关 这里不设置默认的超时时间 由调用方通过ctx控制
+func (c *Client) StreamTo(ctx context.Context, in *pb.Request, w io.Writer) (pb.Compression, error){
+	conn,closeConn,err := c.dial(ctx)
+	if err != nil{
+		return pb.Compression_NONE, err
+	}
+	defer closeConn()
+	stream, err := pb.NewGroupCacheClient(conn).GetStream(ctx, in)
+	if err != nil{
+		return pb.Compression_NONE, fmt.Errorf("can not stream %s/%s from peer %s: %w", in.Group, in.Key, c.name, decodeStreamError(in, err))
+	}
+	first, err := recvChunks(stream, w)
+	if err != nil{
+		return pb.Compression_NONE, decodeStreamError(in, err)
+	}
+	return first.Compression, nil
+}
+
+func (c *Client) getStream(ctx context.Context, grpcClient pb.GroupCacheClient, in *pb.Request, out *pb.Response) error{
+	stream, err := grpcClient.GetStream(ctx, in)
+	if err != nil{
+		return fmt.Errorf("can not stream %s/%s from peer %s: %w", in.Group, in.Key, c.name, decodeStreamError(in, err))
+	}
+	var buf bytes.Buffer
+	first, err := recvChunks(stream, &buf)
+	if err != nil{
+		return decodeStreamError(in, err)
+	}
+	out.Value = buf.Bytes()
+	out.Compression = first.Compression
+	out.Version = first.Version
+	out.Tags = first.Tags
+	return nil
+}
+
+// 依次接收所有分块写入w 返回第一个分块 其中携带了值的大小、压缩算法、版本号和标签
+func recvChunks(stream pb.GroupCache_GetStreamClient, w io.Writer) (*pb.Chunk, error){
+	var (
+		first   *pb.Chunk
+		size, n int64
+	)
+	for{
+		chunk, err := stream.Recv()
+		if err == io.EOF{
+			break
+		}
+		if err != nil{
+			return nil, err
+		}
+		if first == nil{
+			first, size = chunk, chunk.Size
+			// 预先分配好需要的内存
+			if buf, ok := w.(*bytes.Buffer); ok{
+				buf.Grow(int(size))
+			}
+		}
+		m, err := w.Write(chunk.Data)
+		if err != nil{
+			return nil, err
+		}
+		n += int64(m)
+	}
+	if first == nil{
+		return nil, fmt.Errorf("stream truncated: no chunks")
+	}
+	if n != size{
+		return nil, fmt.Errorf("stream truncated: got %d of %d bytes", n, size)
+	}
+	return first, nil
+}
+
+// 实现PeerInvalidator 向节点发送失效通知 失败时按重试策略重试
+func (c *Client) Invalidate(ctx context.Context, in *pb.InvalidateRequest) error{
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	_, err := c.retry.do(ctx, func() error{
+		conn,closeConn,err := c.dial(ctx)
+		if err != nil{
+			return err
+		}
+		defer closeConn()
+		_, err = pb.NewGroupCacheClient(conn).Invalidate(ctx, in)
+		return err
+	})
+	if err != nil{
+		return fmt.Errorf("can not invalidate %s/%s on peer %s: %w", in.Group, in.Key, c.name, err)
 	}
-	// log.Println("this is client.go get funcs ")
 	return nil
 }
-func NewClient(service string)*Client{
-	return &Client{name:service}
+
+// 分页列出节点缓存中的key 用于管理和调试
+func (c *Client) Scan(ctx context.Context, in *pb.ScanRequest) (*pb.ScanResponse, error){
+	ctx, cancel := withDefaultTimeout(ctx)
+	defer cancel()
+	conn,closeConn,err := c.dial(ctx)
+	if err != nil{
+		return nil, err
+	}
+	defer closeConn()
+	resp, err := pb.NewGroupCacheClient(conn).Scan(ctx, in)
+	if err != nil{
+		return nil, fmt.Errorf("can not scan %s on peer %s: %v", in.Group, c.name, err)
+	}
+	return resp, nil
+}
+
+// 实现PeerTransferer 连接在CloseAndRecv之后关闭
+func (c *Client) OpenTransfer(ctx context.Context) (pb.GroupCache_TransferClient, error){
+	conn,closeConn,err := c.dial(ctx)
+	if err != nil{
+		return nil, err
+	}
+	stream, err := pb.NewGroupCacheClient(conn).Transfer(ctx)
+	if err != nil{
+		closeConn()
+		return nil, fmt.Errorf("can not open transfer to peer %s: %v", c.name, err)
+	}
+	return &transferStream{GroupCache_TransferClient: stream, close: closeConn}, nil
+}
+
+// 交接流结束时关闭连接
+type transferStream struct{
+	pb.GroupCache_TransferClient
+	close func()
+}
+
+func (s *transferStream) CloseAndRecv() (*pb.TransferResponse, error){
+	defer s.close()
+	return s.GroupCache_TransferClient.CloseAndRecv()
+}
+
+// ctx没有设置超时时间时 使用默认的超时时间
+func withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc){
+	if _, ok := ctx.Deadline(); ok{
+		return ctx, func(){}
+	}
+	return context.WithTimeout(ctx, defaultPeerTimeout)
+}
+
+func NewClient(service string, opts ...grpc.DialOption)*Client{
+	return &Client{name:service, opts:opts}
 }
 // 进行断言 
-var _ PeerGetter = (*Client)(nil)
\ No newline at end of file
+var _ PeerGetter = (*Client)(nil)
+var _ PeerTransferer = (*Client)(nil)
+var _ PeerInvalidator = (*Client)(nil)
\ No newline at end of file
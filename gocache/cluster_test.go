@@ -0,0 +1,55 @@
+package gocache
+
+import (
+	"context"
+	gpb "goCache/gocache/gocachepb"
+	"testing"
+)
+
+// 通过bufconn访问节点的PeerGetter
+type bufPeer struct {
+	client gpb.GroupCacheClient
+}
+
+func (p bufPeer) Get(ctx context.Context, in *gpb.Request, out *gpb.Response) error {
+	in.WireVersion = wireVersion
+	resp, err := p.client.Get(ctx, in)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(in, resp, out)
+}
+
+func (p bufPeer) Invalidate(ctx context.Context, in *gpb.InvalidateRequest) error {
+	_, err := p.client.Invalidate(ctx, in)
+	return err
+}
+
+func (p bufPeer) OpenTransfer(ctx context.Context) (gpb.GroupCache_TransferClient, error) {
+	return p.client.Transfer(ctx)
+}
+
+// 在同一个进程中启动多个节点 每个节点使用自己的group
+func startCluster(t *testing.T, addrs []string, groupOpts []GroupOption, opts ...ServerOption) (map[string]*Server, map[string]*Group, map[string]*AtomicInt) {
+	servers := map[string]*Server{}
+	groups := map[string]*Group{}
+	loads := map[string]*AtomicInt{}
+	clients := map[string]gpb.GroupCacheClient{}
+	for _, addr := range addrs {
+		n := new(AtomicInt)
+		g := NewGroup("cluster", 0, GetterFunc(
+			func(key string) ([]byte, error) {
+				n.Add(1)
+				return []byte("v" + key), nil
+			}), groupOpts...)
+		svr, err := NewServer(addr, append([]ServerOption{WithGroups(g)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svr.newGetter = func(peer string) PeerGetter { return bufPeer{clients[peer]} }
+		g.RegisterPeers(svr)
+		servers[addr], groups[addr], loads[addr] = svr, g, n
+		clients[addr] = startBufServer(t, svr)
+	}
+	return servers, groups, loads
+}
@@ -0,0 +1,76 @@
+package gocache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// 类型化缓存值的编解码器 节点之间仍然交换编码后的字节
+type Codec[T any] interface {
+	// 将值编码为字节
+	Marshal(v T) ([]byte, error)
+	// 将字节解码为值
+	Unmarshal(data []byte) (T, error)
+}
+
+// 使用json编解码
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// 使用gob编解码 每个值单独编码 包含完整的类型信息
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// 使用msgpack编解码
+type MsgpackCodec[T any] struct{}
+
+func (MsgpackCodec[T]) Marshal(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
+
+// 使用protobuf编解码 T为生成的消息指针类型 例如*pb.Request
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Unmarshal(data []byte) (T, error) {
+	// 通过零值的反射信息创建一个新的消息
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
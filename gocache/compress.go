@@ -0,0 +1,158 @@
+package gocache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	pb "goCache/gocache/gocachepb"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+	缓存值压缩
+	可以分别对内存中存储的值和节点之间传输的值进行压缩
+	压缩后的值在ByteView中记录压缩算法，内存占用按压缩后的大小统计
+*/
+
+// 压缩配置
+type CompressionConfig struct {
+	// 压缩算法
+	Type pb.Compression
+	// 小于该字节数的值不进行压缩
+	Threshold int
+	// 是否压缩内存中存储的缓存值
+	Storage bool
+	// 是否压缩节点之间传输的值
+	Wire bool
+}
+
+// zstd的编码器和解码器是并发安全的 全局共享一份 延迟初始化
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdErr
+}
+
+// 使用指定算法压缩数据
+func compress(typ pb.Compression, b []byte) ([]byte, error) {
+	switch typ {
+	case pb.Compression_NONE:
+		return b, nil
+	case pb.Compression_GZIP:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case pb.Compression_SNAPPY:
+		return snappy.Encode(nil, b), nil
+	case pb.Compression_ZSTD:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(b, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %v", typ)
+}
+
+// 使用指定算法解压数据
+func decompress(typ pb.Compression, b []byte) ([]byte, error) {
+	switch typ {
+	case pb.Compression_NONE:
+		return b, nil
+	case pb.Compression_GZIP:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case pb.Compression_SNAPPY:
+		return snappy.Decode(nil, b)
+	case pb.Compression_ZSTD:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(b, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %v", typ)
+}
+
+// 按配置压缩一个未压缩的值 值太小或者压缩后没有变小则保持原样
+func (c *CompressionConfig) encode(v ByteView) ByteView {
+	if c == nil || c.Type == pb.Compression_NONE || v.c != pb.Compression_NONE || v.Len() < c.Threshold {
+		return v
+	}
+	b, err := compress(c.Type, v.bytes())
+	if err != nil {
+		log.Printf("[gocache] compress value with %v failed: %v", c.Type, err)
+		return v
+	}
+	if len(b) >= v.Len() {
+		return v
+	}
+	v.b, v.s, v.c = b, "", c.Type
+	return v
+}
+
+// 将值解压为原始数据
+func decode(v ByteView) (ByteView, error) {
+	if v.c == pb.Compression_NONE {
+		return v, nil
+	}
+	b, err := decompress(v.c, v.bytes())
+	if err != nil {
+		return ByteView{}, fmt.Errorf("decompress value with %v: %v", v.c, err)
+	}
+	v.b, v.s, v.c = b, "", pb.Compression_NONE
+	return v, nil
+}
+
+// 将值转换为存储到缓存中的形式
+func (g *Group) storageView(v ByteView) (ByteView, error) {
+	if g.compression != nil && g.compression.Storage {
+		if v.c == g.compression.Type {
+			return v, nil
+		}
+		plain, err := decode(v)
+		if err != nil {
+			return ByteView{}, err
+		}
+		return g.compression.encode(plain), nil
+	}
+	return decode(v)
+}
+
+// 将值转换为发送给其他节点的形式
+func (g *Group) wireView(v ByteView) (ByteView, error) {
+	if g.compression != nil && g.compression.Wire {
+		if v.c != pb.Compression_NONE {
+			// 已经压缩过的值直接发送 对端可以根据压缩标记解压
+			return v, nil
+		}
+		return g.compression.encode(v), nil
+	}
+	return decode(v)
+}
@@ -3,56 +3,119 @@ package consistenthash
 import (
 	// "fmt"
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 //实现一致性hash
 /*
-	一致性hash通常将key映射到2^32的空间中 形成一个环
+	一致性hash通常将key映射到2^32(或者2^64)的空间中 形成一个环
 	然后通过map映射虚拟节点，从而解决数据倾斜问题
 */
 
 // 可以自定义hash函数
 type Hash func(data []byte)uint32
 
+// 64位的hash函数 哈希环的空间更大 虚拟节点几乎不会冲突
+type Hash64 func(data []byte) uint64
+
+// 可以选择的64位hash函数
+var (
+	FNV1a  Hash64 = fnv64a
+	XXHash Hash64 = xxhash.Sum64
+)
+
+// 虚拟节点冲突时最多重新计算的次数
+const maxRehash = 16
+
 type Map struct{
 
-	hash Hash
+	hash Hash64
+	// 哈希空间的大小 2^32或者2^64
+	space float64
 	// 虚拟节点的倍数 
 	replicas int
 	// 哈希环
-	keys []int
+	keys []uint64
 	// 虚拟节点和真实节点的映射表 key是虚拟节点的hash值 值是真实节点的名称 
-	hashmap map[int]string
+	hashmap map[uint64]string
+	// 所有真实节点
+	nodes map[string]bool
+	// 和其他虚拟节点冲突过的虚拟节点数量
+	collisions int
 }
 // 允许自定义虚拟节点倍数和hash函数 
 func New(replicas int,fn Hash)*Map{
-	m := &Map{
+	if fn == nil{
+		fn = crc32.ChecksumIEEE
+	}
+	m := New64(replicas, func(data []byte) uint64 {
+		return uint64(fn(data))
+	})
+	m.space = 1 << 32
+	return m
+}
+// 使用64位hash函数 fn为nil时使用xxhash
+func New64(replicas int, fn Hash64) *Map {
+	if fn == nil {
+		fn = XXHash
+	}
+	return &Map{
 		replicas: replicas,
 		hash: fn,
-		hashmap: make(map[int]string),
-	}
-	if m.hash == nil{
-		m.hash = crc32.ChecksumIEEE
+		space: math.Pow(2, 64),
+		hashmap: make(map[uint64]string),
+		nodes: make(map[string]bool),
 	}
-	return m
 }
 // 实现添加真实节点的add方法 允许传入0或者多个真实节点的名称 
+// 添加后按节点名称的顺序重新构建哈希环 这样冲突的处理结果与添加顺序无关
 func (m *Map) Add(keys ...string){
 	for _,key := range keys{
+		m.nodes[key] = true
+	}
+	nodes := make([]string, 0, len(m.nodes))
+	for node := range m.nodes{
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	m.keys = m.keys[:0]
+	m.hashmap = make(map[uint64]string, len(nodes)*m.replicas)
+	m.collisions = 0
+	for _,key := range nodes{
 		// 一个真实节点创造多个虚拟节点
 		for i:=0;i < m.replicas;i++{
 			//虚拟节点名称是strconv.Itoa(i)+key 拼接起来01，11，21类似于
-			hash := int(m.hash([]byte(strconv.Itoa(i)+key)))
+			name := strconv.Itoa(i)+key
+			hash := m.hash([]byte(name))
+			// 和已有的虚拟节点冲突时 加上后缀重新计算
+			_, collided := m.hashmap[hash]
+			if collided{
+				m.collisions++
+			}
+			for j := 1; collided && j <= maxRehash; j++{
+				hash = m.hash([]byte(name + "#" + strconv.Itoa(j)))
+				_, collided = m.hashmap[hash]
+			}
+			if collided{
+				// 仍然冲突 放弃这个虚拟节点
+				continue
+			}
 			m.keys = append(m.keys, hash)
-			// fmt.Println(key)
 			// 真实节点和虚拟节点映射 
 			m.hashmap[hash] = key
 		}
 	}
 	// 环上的哈希值排序 
-	sort.Ints(m.keys)
+	sort.Slice(m.keys, func(i, j int) bool { return m.keys[i] < m.keys[j] })
+}
+
+// 和其他虚拟节点冲突过的虚拟节点数量 冲突的虚拟节点会加上后缀重新计算hash值
+func (m *Map) Collisions() int {
+	return m.collisions
 }
 
 //  实现选择节点的get方法 
@@ -60,10 +123,76 @@ func (m *Map)Get(key string)string{
 	if len(m.keys) == 0{
 		return ""
 	}
-	hash := int(m.hash([]byte(key)))
+	hash := m.hash([]byte(key))
 	// 找到第一个节点 
 	index := sort.Search(len(m.keys),func(i int) bool {
 		return m.keys[i] >= hash
 	})
 	return m.hashmap[m.keys[index%len(m.keys)]]
-}
\ No newline at end of file
+}
+
+// 返回key在哈希环上顺时针方向的前n个不同的真实节点 第一个就是Get返回的节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := m.hash([]byte(key))
+	index := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	// 沿着环走一圈 跳过同一个真实节点的其他虚拟节点
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashmap[m.keys[(index+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// 真实节点的数量
+func (m *Map) Len() int {
+	return len(m.nodes)
+}
+
+// 哈希空间的分布情况 用于选择虚拟节点的倍数
+type DistributionReport struct {
+	// 每个真实节点负责的哈希空间比例 总和为1
+	Shares map[string]float64
+	// 最小和最大的比例
+	Min, Max float64
+	// 比例的标准差除以平均值 越小越均匀
+	RelStdDev float64
+	// 冲突的虚拟节点数量
+	Collisions int
+}
+
+// 计算每个真实节点负责的哈希空间比例
+// 每个虚拟节点负责从上一个虚拟节点(不含)到自己(含)之间的哈希值
+func (m *Map) Distribution() DistributionReport {
+	report := DistributionReport{Shares: map[string]float64{}, Collisions: m.collisions}
+	if len(m.keys) == 0 {
+		return report
+	}
+	last := m.keys[len(m.keys)-1]
+	// 第一个虚拟节点负责跨过0的那一段
+	report.Shares[m.hashmap[m.keys[0]]] += (float64(m.keys[0]) + m.space - float64(last)) / m.space
+	for i := 1; i < len(m.keys); i++ {
+		report.Shares[m.hashmap[m.keys[i]]] += float64(m.keys[i]-m.keys[i-1]) / m.space
+	}
+	avg := 1 / float64(len(m.nodes))
+	report.Min = 1
+	var variance float64
+	for node := range m.nodes {
+		share := report.Shares[node]
+		report.Shares[node] = share
+		report.Min = math.Min(report.Min, share)
+		report.Max = math.Max(report.Max, share)
+		variance += (share - avg) * (share - avg)
+	}
+	report.RelStdDev = math.Sqrt(variance/float64(len(m.nodes))) / avg
+	return report
+}
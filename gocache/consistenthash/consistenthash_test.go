@@ -1,6 +1,9 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -31,3 +34,112 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	// 环上的虚拟节点为 2 4 6 12 14 16 22 24 26
+	testCases := map[string][]string{
+		"2":  {"2", "4", "6"},
+		"11": {"2", "4", "6"},
+		"23": {"4", "6", "2"},
+		"27": {"2", "4", "6"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 3); !reflect.DeepEqual(got, v) {
+			t.Errorf("GetN(%s, 3) = %v, want %v", k, got, v)
+		}
+	}
+	// 节点数不足时只返回所有节点
+	if got := hash.GetN("23", 5); len(got) != 3 {
+		t.Errorf("GetN should return at most 3 distinct nodes, got %v", got)
+	}
+	if got := hash.GetN("23", 1); !reflect.DeepEqual(got, []string{hash.Get("23")}) {
+		t.Errorf("first node of GetN should equal Get, got %v", got)
+	}
+}
+
+func TestGetNBounded(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	loads := map[string]int64{"2": 0, "4": 0, "6": 0}
+	load := func(node string) int64 { return loads[node] }
+
+	// 负载都为0时与GetN相同
+	if got := GetNBounded(hash, "11", 3, 1.25, load); !reflect.DeepEqual(got, []string{"2", "4", "6"}) {
+		t.Errorf("GetNBounded without load = %v", got)
+	}
+	// 总负载5 上限为ceil(1.25*6/3)=3 跳过达到上限的节点2
+	loads["2"], loads["4"], loads["6"] = 3, 2, 0
+	if got := GetNBounded(hash, "11", 1, 1.25, load); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("saturated node should be skipped, got %v", got)
+	}
+	// 所有节点都达到上限时按原来的顺序返回
+	loads["6"] = 1
+	if got := GetNBounded(hash, "11", 2, 0.1, load); !reflect.DeepEqual(got, []string{"2", "4"}) {
+		t.Errorf("all saturated should fall back to GetN, got %v", got)
+	}
+}
+
+// 虚拟节点冲突时重新计算 结果与添加顺序无关
+func TestCollisions(t *testing.T) {
+	// 只取hash值的最后一位 很容易冲突
+	hash := func(data []byte) uint32 {
+		return uint32(crc32.ChecksumIEEE(data) % 10)
+	}
+	a, b := New(3, hash), New(3, hash)
+	a.Add("n1", "n2", "n3")
+	b.Add("n3")
+	b.Add("n2", "n1")
+	if a.Collisions() == 0 {
+		t.Fatalf("collisions should be detected")
+	}
+	if len(a.keys) != len(a.hashmap) || !reflect.DeepEqual(a.keys, b.keys) || !reflect.DeepEqual(a.hashmap, b.hashmap) {
+		t.Fatalf("ring should not depend on add order")
+	}
+	for i := 1; i < len(a.keys); i++ {
+		if a.keys[i] == a.keys[i-1] {
+			t.Fatalf("ring keys should be unique")
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	nodes := []string{"10.0.0.1:8001", "10.0.0.2:8001", "10.0.0.3:8001", "10.0.0.4:8001"}
+	for _, fn := range []Hash64{XXHash, FNV1a} {
+		var prev float64
+		for i, replicas := range []int{1, 50, 500} {
+			m := New64(replicas, fn)
+			m.Add(nodes...)
+			report := m.Distribution()
+			total := 0.0
+			for _, share := range report.Shares {
+				total += share
+			}
+			if len(report.Shares) != len(nodes) || math.Abs(total-1) > 1e-9 || report.Min > report.Max {
+				t.Fatalf("unexpected report %+v", report)
+			}
+			// 虚拟节点越多分布越均匀
+			if i > 0 && report.RelStdDev >= prev {
+				t.Errorf("replicas %d should be more uniform: %.3f >= %.3f", replicas, report.RelStdDev, prev)
+			}
+			prev = report.RelStdDev
+		}
+	}
+	// 32位hash的比例同样按2^32计算
+	m := New(50, nil)
+	m.Add(nodes...)
+	total := 0.0
+	for _, share := range m.Distribution().Shares {
+		total += share
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Fatalf("shares should sum to 1, got %f", total)
+	}
+}
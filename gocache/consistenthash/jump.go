@@ -0,0 +1,67 @@
+package consistenthash
+
+import "sort"
+
+// jump consistent hash 不需要虚拟节点 分布非常均匀
+// 节点按名称排序后编号 新节点的名称排在最后时只有1/N的key会移动
+// 从中间删除节点时编号会整体变化 适合节点只增加或者按顺序编号的集群
+type Jump struct {
+	hash  Hash64
+	nodes []string
+}
+
+// fn为nil时使用FNV-1a
+func NewJump(fn Hash64) *Jump {
+	if fn == nil {
+		fn = fnv64a
+	}
+	return &Jump{hash: fn}
+}
+
+// 各个节点传入的顺序可能不同 排序后保证所有节点得到相同的编号
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !contains(j.nodes, node) {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+	sort.Strings(j.nodes)
+}
+
+// Lamping和Veach的jump consistent hash算法 返回[0, buckets)之间的编号
+func jumpHash(key uint64, buckets int) int {
+	var b, i int64 = -1, 0
+	for i < int64(buckets) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(j.hash([]byte(key)), len(j.nodes))]
+}
+
+// owner之后按编号顺序选择节点
+func (j *Jump) GetN(key string, n int) []string {
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	index := jumpHash(j.hash([]byte(key)), len(j.nodes))
+	nodes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, j.nodes[(index+i)%len(j.nodes)])
+	}
+	return nodes
+}
+
+func (j *Jump) Len() int {
+	return len(j.nodes)
+}
@@ -0,0 +1,117 @@
+package consistenthash
+
+import "sort"
+
+// Maglev默认的查找表大小 需要是质数 并且远大于节点数
+const DefaultMaglevTableSize = 65537
+
+// Maglev哈希 预先为每个节点计算一个排列 轮流填充查找表
+// 每个节点在表中占用的位置数量几乎相同 查找时间为O(1)
+type Maglev struct {
+	hash  Hash64
+	size  int
+	nodes []string
+	// 查找表 值为nodes中的下标
+	table []int
+}
+
+// size需要是质数 不是大于1的质数时使用DefaultMaglevTableSize fn为nil时使用FNV-1a
+func NewMaglev(size int, fn Hash64) *Maglev {
+	// 非质数时排列无法覆盖整个查找表 填充不会结束
+	if !isPrime(size) {
+		size = DefaultMaglevTableSize
+	}
+	if fn == nil {
+		fn = fnv64a
+	}
+	return &Maglev{hash: fn, size: size}
+}
+
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !contains(m.nodes, node) {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+	// 排序后保证所有节点得到相同的查找表
+	sort.Strings(m.nodes)
+	m.populate()
+}
+
+// 按论文中的方法填充查找表
+func (m *Maglev) populate() {
+	n := len(m.nodes)
+	if n == 0 {
+		m.table = nil
+		return
+	}
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	for i, node := range m.nodes {
+		offsets[i] = m.hash([]byte(node)) % uint64(m.size)
+		skips[i] = m.hash([]byte(node+"\x00skip"))%uint64(m.size-1) + 1
+	}
+	next := make([]uint64, n)
+	m.table = make([]int, m.size)
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	for filled := 0; filled < m.size; {
+		for i := 0; i < n && filled < m.size; i++ {
+			// 找到该节点排列中下一个还没有被占用的位置
+			for {
+				pos := (offsets[i] + next[i]*skips[i]) % uint64(m.size)
+				next[i]++
+				if m.table[pos] < 0 {
+					m.table[pos] = i
+					filled++
+					break
+				}
+			}
+		}
+	}
+}
+
+func (m *Maglev) Get(key string) string {
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[m.hash([]byte(key))%uint64(m.size)]]
+}
+
+// owner之后沿查找表向后选择不同的节点
+func (m *Maglev) GetN(key string, n int) []string {
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	pos := int(m.hash([]byte(key)) % uint64(m.size))
+	nodes := make([]string, 0, n)
+	seen := make(map[int]bool, n)
+	for i := 0; i < m.size && len(nodes) < n; i++ {
+		idx := m.table[(pos+i)%m.size]
+		if !seen[idx] {
+			seen[idx] = true
+			nodes = append(nodes, m.nodes[idx])
+		}
+	}
+	return nodes
+}
+
+func (m *Maglev) Len() int {
+	return len(m.nodes)
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
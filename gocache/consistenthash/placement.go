@@ -0,0 +1,73 @@
+package consistenthash
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+/*
+	节点选择算法
+	Server通过Placement决定key由哪些节点负责 可以选择:
+	  - Map: 带虚拟节点的哈希环 默认使用
+	  - Rendezvous: 最高随机权重(HRW) 每个key对所有节点打分 选择分数最高的节点
+	  - Jump: jump consistent hash 不需要额外内存 节点按名称排序后编号
+	  - Maglev: 预先计算的查找表 查找时间为O(1)
+*/
+
+// 节点选择算法
+type Placement interface {
+	// 添加真实节点
+	Add(nodes ...string)
+	// 返回负责key的节点 没有节点时返回空字符串
+	Get(key string) string
+	// 返回负责key的前n个不同节点 第一个就是Get返回的节点 之后是owner不可用时依次选择的节点
+	GetN(key string, n int) []string
+	// 真实节点的数量
+	Len() int
+}
+
+var (
+	_ Placement = (*Map)(nil)
+	_ Placement = (*Rendezvous)(nil)
+	_ Placement = (*Jump)(nil)
+	_ Placement = (*Maglev)(nil)
+)
+
+// 默认的64位哈希函数
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+/*
+	有界负载的一致性哈希
+	每个节点的负载上限为 ceil(factor * (总负载+1) / 节点数)
+	查找时按GetN的顺序跳过负载已经达到上限的节点 少数热门key不会压垮同一个节点
+*/
+
+// 返回key的前n个负载低于上限的节点 顺序与GetN相同
+// load返回节点当前的负载 所有节点都达到上限时返回GetN的结果
+func GetNBounded(p Placement, key string, n int, factor float64, load func(node string) int64) []string {
+	all := p.GetN(key, p.Len())
+	if len(all) == 0 {
+		return nil
+	}
+	var total int64
+	loads := make([]int64, len(all))
+	for i, node := range all {
+		loads[i] = load(node)
+		total += loads[i]
+	}
+	capacity := int64(math.Ceil(factor * float64(total+1) / float64(len(all))))
+	nodes := make([]string, 0, n)
+	for i, node := range all {
+		if loads[i] < capacity && len(nodes) < n {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return p.GetN(key, n)
+	}
+	return nodes
+}
@@ -0,0 +1,145 @@
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+var placements = []struct {
+	name string
+	new  func() Placement
+	// 增加节点时key是否只会移动到新节点 Maglev会有少量key在旧节点之间移动
+	minimal bool
+}{
+	{"ring", func() Placement { return New(100, nil) }, true},
+	{"rendezvous", func() Placement { return NewRendezvous(nil) }, true},
+	{"jump", func() Placement { return NewJump(nil) }, true},
+	{"maglev", func() Placement { return NewMaglev(0, nil) }, false},
+}
+
+func testNodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("10.0.0.%02d:8001", i)
+	}
+	return nodes
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+	return keys
+}
+
+// 每个节点负责的key数量接近平均值
+func TestPlacementDistribution(t *testing.T) {
+	nodes, keys := testNodes(10), testKeys(100000)
+	for _, pc := range placements {
+		p := pc.new()
+		p.Add(nodes...)
+		counts := map[string]int{}
+		for _, key := range keys {
+			counts[p.Get(key)]++
+		}
+		avg := float64(len(keys)) / float64(len(nodes))
+		for _, node := range nodes {
+			if share := float64(counts[node]) / avg; share < 0.6 || share > 1.4 {
+				t.Errorf("%s: node %s owns %.2f of average", pc.name, node, share)
+			}
+		}
+	}
+}
+
+// 增加一个节点时 移动的key接近1/11
+func TestPlacementMovedKeys(t *testing.T) {
+	nodes, keys := testNodes(11), testKeys(100000)
+	for _, pc := range placements {
+		before, after := pc.new(), pc.new()
+		before.Add(nodes[:10]...)
+		after.Add(nodes...)
+		moved := 0
+		for _, key := range keys {
+			if old, cur := before.Get(key), after.Get(key); old != cur {
+				moved++
+				if pc.minimal && cur != nodes[10] {
+					t.Errorf("%s: key %s moved from %s to %s instead of new node", pc.name, key, old, cur)
+					break
+				}
+			}
+		}
+		// 理想情况为1/11
+		if ratio := float64(moved) / float64(len(keys)); ratio > 2.0/11 {
+			t.Errorf("%s: %.3f of keys moved", pc.name, ratio)
+		}
+	}
+}
+
+func TestPlacementGetN(t *testing.T) {
+	nodes := testNodes(5)
+	for _, pc := range placements {
+		p := pc.new()
+		if p.Get("k") != "" || p.GetN("k", 3) != nil {
+			t.Errorf("%s: empty placement should return no node", pc.name)
+		}
+		// 节点传入的顺序不影响结果
+		q := pc.new()
+		p.Add(nodes...)
+		for i := len(nodes) - 1; i >= 0; i-- {
+			q.Add(nodes[i])
+		}
+		for _, key := range testKeys(100) {
+			got := p.GetN(key, 10)
+			seen := map[string]bool{}
+			for _, node := range got {
+				seen[node] = true
+			}
+			if len(got) != len(nodes) || len(seen) != len(nodes) || got[0] != p.Get(key) {
+				t.Fatalf("%s: GetN(%s) = %v", pc.name, key, got)
+			}
+			if pc.name != "ring" && q.Get(key) != got[0] {
+				t.Fatalf("%s: placement should not depend on add order", pc.name)
+			}
+		}
+	}
+}
+
+// 空节点列表和不合法的表大小都不能导致填充查找表时死循环
+func TestMaglevEmptyAndSize(t *testing.T) {
+	m := NewMaglev(0, nil)
+	m.Add()
+	if m.Get("k") != "" {
+		t.Fatalf("empty maglev should return no node")
+	}
+	for _, size := range []int{10, 1} {
+		m := NewMaglev(size, nil)
+		if m.size != DefaultMaglevTableSize {
+			t.Fatalf("size %d: expected fallback to %d, got %d", size, DefaultMaglevTableSize, m.size)
+		}
+		m.Add(testNodes(3)...)
+		if m.Get("k") == "" {
+			t.Fatalf("size %d: expected a node", size)
+		}
+	}
+	m = NewMaglev(13, nil)
+	m.Add(testNodes(3)...)
+	if m.size != 13 || len(m.table) != 13 {
+		t.Fatalf("prime size should be kept, got %d", m.size)
+	}
+}
+
+func BenchmarkPlacementGet(b *testing.B) {
+	keys := testKeys(1024)
+	for _, n := range []int{10, 100} {
+		for _, pc := range placements {
+			p := pc.new()
+			p.Add(testNodes(n)...)
+			b.Run(fmt.Sprintf("%s/%d", pc.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package consistenthash
+
+import "sort"
+
+// 最高随机权重哈希 每个key对所有节点计算分数 分数最高的节点负责该key
+// 增删节点时只有该节点负责的key会移动 查找时间为O(节点数)
+type Rendezvous struct {
+	hash  Hash64
+	nodes []string
+}
+
+// fn为nil时使用FNV-1a
+func NewRendezvous(fn Hash64) *Rendezvous {
+	if fn == nil {
+		fn = fnv64a
+	}
+	return &Rendezvous{hash: fn}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !contains(r.nodes, node) {
+			r.nodes = append(r.nodes, node)
+		}
+	}
+}
+
+func (r *Rendezvous) score(node, key string) uint64 {
+	return r.hash([]byte(node + "\x00" + key))
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var best string
+	var max uint64
+	for _, node := range r.nodes {
+		if s := r.score(node, key); best == "" || s > max {
+			best, max = node, s
+		}
+	}
+	return best
+}
+
+// 按分数从高到低返回前n个节点
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	scores := make(map[string]uint64, len(r.nodes))
+	nodes := make([]string, len(r.nodes))
+	copy(nodes, r.nodes)
+	for _, node := range nodes {
+		scores[node] = r.score(node, key)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return scores[nodes[i]] > scores[nodes[j]] })
+	return nodes[:n]
+}
+
+func (r *Rendezvous) Len() int {
+	return len(r.nodes)
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,7 @@
 package etcdregistry
 
 import (
+	"context"
 	"fmt"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -16,17 +17,26 @@ import (
 )
 
 // 获取grpc连接 通过ectd客户端和服务名字
-func EtcdDial(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
+// opts为额外的连接配置 例如最大消息大小
+func EtcdDial(c *clientv3.Client, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return EtcdDialContext(context.Background(), c, service, opts...)
+}
+
+// 和EtcdDial一样 ctx取消或超时后停止阻塞等待连接建立
+func EtcdDialContext(ctx context.Context, c *clientv3.Client, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	etcdResolver, err := resolver.NewBuilder(c) //使用etcd客户端构建了一个服务发现的构建器。
 	if err != nil {                             //检查是否在创建etcd服务发现构建器时发生了错误
 		return nil, err
 	}
 	fmt.Println("Connecting to service:", service)
-	return grpc.Dial(
-		"etcd:///"+service,                                       //指定了服务的地址
-		grpc.WithResolvers(etcdResolver),                         //用于服务发现的解析器
-		grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，这里使用了不安全的连接（insecure）
-		grpc.WithBlock(),                                         //用于在连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码。
-		grpc.FailOnNonTempDialError(true),
+	return grpc.DialContext(
+		ctx,
+		"etcd:///"+service, //指定了服务的地址
+		append([]grpc.DialOption{
+			grpc.WithResolvers(etcdResolver),                         //用于服务发现的解析器
+			grpc.WithTransportCredentials(insecure.NewCredentials()), //用于设置gRPC连接的传输层安全性，这里使用了不安全的连接（insecure）
+			grpc.WithBlock(),                                         //用于在连接建立之前阻塞，确保连接建立成功后再继续执行后续的代码。
+			grpc.FailOnNonTempDialError(true),
+		}, opts...)...,
 	)
 } // 最后返回一个指向已建立连接的grpc.ClientConn类型的指针，或者在发生错误时返回一个错误
\ No newline at end of file
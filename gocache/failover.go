@@ -0,0 +1,113 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+/*
+	故障转移
+	owner不可用时按一致性哈希环的顺序依次请求后继节点，后继节点收到请求后不再转发，
+	直接从自己的缓存或数据源获取。所有后继节点都失败后才由当前节点加载，
+	当前节点不是下一个负责该key的节点时不写入mainCache，避免污染缓存。
+*/
+
+// 故障转移配置
+type FailoverConfig struct {
+	// owner不可用时最多尝试的后继节点数量
+	Replicas int
+	// 每次请求的超时时间 包括请求owner 为0时使用Client的默认超时时间
+	AttemptTimeout time.Duration
+}
+
+// 开启故障转移 需要注册的PeerPicker实现FailoverPicker
+func WithFailover(cfg FailoverConfig) GroupOption {
+	return func(g *Group) {
+		g.failover = &cfg
+	}
+}
+
+// 为一次请求设置超时时间
+func (g *Group) attemptContext() (context.Context, context.CancelFunc) {
+	if g.failover != nil && g.failover.AttemptTimeout > 0 {
+		return context.WithTimeout(context.Background(), g.failover.AttemptTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// 从owner节点获取 并记录结果
+func (g *Group) getFromOwner(peer PeerGetter, key string) (ByteView, error) {
+	ctx, cancel := g.attemptContext()
+	defer cancel()
+	var (
+		value ByteView
+		err   error
+	)
+	if g.hedging != nil {
+		value, err = g.getHedged(ctx, peer, key)
+	} else {
+		value, err = g.getFromPeer(ctx, peer, key, false)
+	}
+	switch {
+	case err == nil || errors.Is(err, ErrNotFound):
+		g.Stats.PeerLoads.Add(1)
+	case ctx.Err() == context.DeadlineExceeded:
+		g.Stats.PeerTimeouts.Add(1)
+	default:
+		g.Stats.PeerErrors.Add(1)
+	}
+	return value, err
+}
+
+// owner不可用时依次请求后继节点 都失败后在本地加载
+func (g *Group) loadFailover(key string) (interface{}, error) {
+	picker, ok := g.peers.(FailoverPicker)
+	if !ok {
+		return g.getLocally(key)
+	}
+	peers, local := picker.PickFailover(key, g.failover.Replicas)
+	for _, peer := range peers {
+		ctx, cancel := g.attemptContext()
+		value, err := g.getFromPeer(ctx, peer, key, true)
+		timeout := ctx.Err() == context.DeadlineExceeded
+		cancel()
+		switch {
+		case err == nil || errors.Is(err, ErrNotFound):
+			g.Stats.FailoverLoads.Add(1)
+			if err != nil {
+				return nil, err
+			}
+			return value, nil
+		case timeout:
+			g.Stats.FailoverTimeouts.Add(1)
+		default:
+			g.Stats.FailoverErrors.Add(1)
+		}
+		log.Println("[gocache] Failed to get from failover peer", err)
+	}
+	if local {
+		// 当前节点就是下一个负责该key的节点 正常写入缓存
+		return g.getLocally(key)
+	}
+	g.Stats.FallbackLoads.Add(1)
+	return g.fetchLocally(key)
+}
+
+// 处理其他节点故障转移过来的请求 不再转发 缓存未命中时从数据源加载
+func (g *Group) getNoForward(key string) (ByteView, error) {
+	if v, _, ok := g.lookupCache(key); ok && v.fresh(time.Now()) {
+		g.Stats.CacheHits.Add(1)
+		g.hooks.hit(key)
+		return v, nil
+	}
+	g.hooks.miss(key)
+	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+		return g.getLocally(key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
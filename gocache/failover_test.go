@@ -0,0 +1,109 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	pb "goCache/gocache/gocachepb"
+	"testing"
+	"time"
+)
+
+// 用于测试的PeerGetter
+type fakePeer struct {
+	value string
+	err   error
+	// 为true时一直阻塞到ctx结束 模拟节点无响应
+	hang bool
+	// 返回前的延迟 期间ctx结束时返回ctx的错误
+	delay    time.Duration
+	calls    AtomicInt
+	canceled AtomicInt
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.calls.Add(1)
+	if p.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			p.canceled.Add(1)
+			return ctx.Err()
+		}
+	}
+	if p.err != nil {
+		return p.err
+	}
+	out.Value = []byte(p.value)
+	return nil
+}
+
+// 用于测试的PeerPicker 所有key都由owner负责
+type fakePicker struct {
+	owner    PeerGetter
+	replicas []PeerGetter
+	local    bool
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.owner, p.owner != nil
+}
+
+func (p *fakePicker) PickFailover(key string, n int) ([]PeerGetter, bool) {
+	if n < len(p.replicas) {
+		return p.replicas[:n], false
+	}
+	return p.replicas, p.local
+}
+
+func TestFailover(t *testing.T) {
+	owner := &fakePeer{err: errors.New("connection refused")}
+	hung := &fakePeer{hang: true}
+	replica := &fakePeer{value: "replica"}
+	g := NewGroup("failover", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithFailover(FailoverConfig{Replicas: 2, AttemptTimeout: 50 * time.Millisecond}))
+	picker := &fakePicker{owner: owner, replicas: []PeerGetter{hung, replica}}
+	g.RegisterPeers(picker)
+
+	// owner失败 第一个后继节点超时 第二个后继节点成功
+	if view, err := g.Get("k1"); err != nil || view.String() != "replica" {
+		t.Fatalf("failover should get value from replica, got %q %v", view.String(), err)
+	}
+	if g.Stats.PeerErrors.Get() != 1 || g.Stats.FailoverTimeouts.Get() != 1 || g.Stats.FailoverLoads.Get() != 1 {
+		t.Fatalf("unexpected stats %+v", g.Stats)
+	}
+
+	// 所有节点都失败 由当前节点加载 但不写入mainCache
+	replica.err = errors.New("unavailable")
+	if view, err := g.Get("k2"); err != nil || view.String() != "local" {
+		t.Fatalf("should fall back to local load, got %q %v", view.String(), err)
+	}
+	if g.Stats.FallbackLoads.Get() != 1 {
+		t.Fatalf("fallback load should be counted, got %d", g.Stats.FallbackLoads.Get())
+	}
+	if _, ok := g.mainCache.get("k2"); ok {
+		t.Fatalf("fallback load should not populate mainCache")
+	}
+
+	// 当前节点是下一个负责该key的节点 写入mainCache
+	picker.replicas = []PeerGetter{replica}
+	picker.local = true
+	if _, err := g.Get("k3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("k3"); !ok {
+		t.Fatalf("successor load should populate mainCache")
+	}
+
+	// owner确认不存在时不再故障转移
+	owner.err = ErrNotFound
+	calls := replica.calls.Get()
+	if _, err := g.Get("k4"); !errors.Is(err, ErrNotFound) || replica.calls.Get() != calls {
+		t.Fatalf("not found from owner should not fail over, got %v", err)
+	}
+}
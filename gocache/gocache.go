@@ -7,6 +7,8 @@
 package gocache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"goCache/gocache/singleflight"
 	"log"
@@ -35,6 +37,23 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// 可以同时返回标签的Getter 标签随值一起缓存 用于InvalidateTag
+type TaggedGetter interface {
+	Getter
+	GetTagged(key string) (value []byte, tags []string, err error)
+}
+
+type TaggedGetterFunc func(key string) ([]byte, []string, error)
+
+func (f TaggedGetterFunc) Get(key string) ([]byte, error) {
+	value, _, err := f(key)
+	return value, err
+}
+
+func (f TaggedGetterFunc) GetTagged(key string) ([]byte, []string, error) {
+	return f(key)
+}
+
 // 定义group
 /*
 	一个group可以认为是一个缓存的命名空间，每个group都拥有一个唯一的name
@@ -56,6 +75,42 @@ type Group struct {
 	loader *singleflight.Group
 	// key的统计信息
 	keys map[string]*KeyStats
+	// 压缩配置 为nil表示不压缩
+	compression *CompressionConfig
+	// 故障转移配置 为nil表示不进行故障转移
+	failover *FailoverConfig
+	// 请求对冲 为nil表示不进行对冲
+	hedging *hedger
+	// 缓存值的有效期 0表示永不过期
+	ttl time.Duration
+	// 过期值的使用配置 为nil表示过期后必须重新加载
+	stale *StaleConfig
+	// 正在后台刷新的key
+	revalidating sync.Map
+	// 提前刷新 为nil表示不提前刷新
+	refresher *refresher
+	// 副本配置 为nil表示不复制
+	replication *ReplicationConfig
+	// 失效的key的墓碑
+	tombstones *tombstones
+	// 生命周期钩子
+	hooks Hooks
+	// 在缓存之上额外缓存的数据 例如TypedGroup解码后的对象 为nil表示没有
+	derived derivedCache
+	// TypedGroup解码后对象缓存的容量 0表示使用默认值
+	decodedBytes int64
+	// 统计信息
+	Stats Stats
+}
+
+// 创建group时的可选配置
+type GroupOption func(*Group)
+
+// 开启缓存值压缩
+func WithCompression(cfg CompressionConfig) GroupOption {
+	return func(g *Group) {
+		g.compression = &cfg
+	}
 }
 
 // 通过封装原子类 来实现请求次数的统计 保证并发安全
@@ -71,6 +126,45 @@ func (i *AtomicInt) Get() int64 {
 	return atomic.LoadInt64((*int64)(i))
 }
 
+// group的统计信息
+type Stats struct {
+	Gets      AtomicInt // Get请求次数
+	CacheHits AtomicInt // 缓存命中次数
+	// 从owner节点获取的结果
+	PeerLoads    AtomicInt // 成功
+	PeerErrors   AtomicInt // 失败
+	PeerTimeouts AtomicInt // 超时
+	// owner不可用时从后继节点获取的结果
+	FailoverLoads    AtomicInt // 成功
+	FailoverErrors   AtomicInt // 失败
+	FailoverTimeouts AtomicInt // 超时
+	// 从本地数据源获取的结果
+	LocalLoads    AtomicInt // 成功
+	LocalLoadErrs AtomicInt // 失败
+	// 所有节点都不可用 由当前节点加载但不写入mainCache的次数
+	FallbackLoads AtomicInt
+	// 发出的对冲请求次数 以及对冲请求先成功返回的次数
+	HedgedRequests AtomicInt
+	HedgeWins      AtomicInt
+	// 返回过期值并在后台刷新的次数 以及后台刷新的结果
+	StaleHits      AtomicInt
+	Revalidations  AtomicInt
+	RevalidateErrs AtomicInt
+	// 加载失败时返回过期值的次数
+	StaleOnError AtomicInt
+	// 提前刷新的结果 以及因为并发限制跳过的次数
+	Refreshes      AtomicInt
+	RefreshErrs    AtomicInt
+	RefreshSkipped AtomicInt
+	// 推送副本成功和失败的次数 以及副本节点拒绝写入的次数
+	ReplicaPushes   AtomicInt
+	ReplicaErrs     AtomicInt
+	ReplicaRejected AtomicInt
+	// 生效的失效通知次数 以及因为加载期间被失效或者写入了更新的值而没有写入缓存的次数
+	Invalidations    AtomicInt
+	InvalidatedLoads AtomicInt
+}
+
 type KeyStats struct { //Key的统计信息
 	firstGetTime time.Time //第一次请求的时间
 	remoteCnt    AtomicInt //请求的次数（利用atomic包封装的原子类）
@@ -87,7 +181,7 @@ var (
 
 // 实现new函数
 // TODO: 实现传入不同参数达到不同的淘汰算法 LRU LFU
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -100,6 +194,29 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		loader:    &singleflight.Group{},
 		keys:      map[string]*KeyStats{},
 		hotCache: cache{cacheBytes: cacheBytes},
+		tombstones: newTombstones(defaultTombstoneTTL),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.hooks.OnEvict != nil || g.derived != nil {
+		g.mainCache.onEvict = g.evicted
+	}
+	if g.derived != nil {
+		g.hotCache.onEvict = func(key string, _ ByteView, _ EvictReason) {
+			g.derived.forget(key)
+		}
+	}
+	// 开启副本后 owner不可用时从副本节点读取
+	if g.replication != nil && g.failover == nil && g.replication.Factor > 1 {
+		g.failover = &FailoverConfig{Replicas: g.replication.Factor - 1}
+	}
+	// 同名的旧group不再可以访问 停止它的后台任务
+	if old, ok := groups[name]; ok {
+		old.Close()
+	}
+	if g.refresher != nil {
+		go g.refresher.run()
 	}
 	groups[name] = g
 	return g
@@ -114,22 +231,64 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// 返回所有的group
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	return list
+}
+
 // 核心方法 通过key来获取到缓存中的value
 func (g *Group) Get(key string) (ByteView, error) {
+	v, err := g.get(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	// 缓存中的值可能是压缩过的 返回前解压
+	return decode(v)
+}
+
+// 获取缓存中存储形式的值 可能是压缩过的
+func (g *Group) get(key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.Stats.Gets.Add(1)
+	v, hot, ok := g.lookupCache(key)
+	if !ok {
+		g.hooks.miss(key)
+		// 如果缓存没有命中，则调用local方法
+		return g.load(key)
+	}
+	now := time.Now()
+	if v.fresh(now) {
+		g.Stats.CacheHits.Add(1)
+		g.hooks.hit(key)
+		if g.refresher != nil && !hot {
+			g.refresher.touch(key, now)
+		}
+		return v, nil
+	}
+	// 缓存值已经过期
+	return g.getExpired(key, v, hot, now)
+}
+
+// 查找两张cache hot表示是否在hotCache中找到
+func (g *Group) lookupCache(key string) (value ByteView, hot bool, ok bool) {
 	// 两张cache 先查看hotcache中有没有对应的缓存
 	if v, ok := g.hotCache.get(key); ok {
 		log.Println("hotCache get")
-		return v, nil
+		return v, true, true
 	}
 	if v, ok := g.mainCache.get(key); ok {
 		log.Println("maincache get")
-		return v, nil
+		return v, false, true
 	}
-	// 如果缓存没有命中，则调用local方法
-	return g.load(key)
+	return ByteView{}, false, false
 }
 
 // 注册节点
@@ -156,10 +315,22 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	viewi, err := g.loader.Do(key, func() (interface{}, error) {
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				if value, err = g.getFromOwner(peer, key); err == nil {
 					return value, nil
 				}
+				// 负责该key的节点已经确认数据源中不存在 不需要再从本地加载
+				if errors.Is(err, ErrNotFound) {
+					return nil, err
+				}
 				log.Println("[gocache] Failed to get from peer", err)
+				if g.failover != nil {
+					return g.loadFailover(key)
+				}
+			}
+			// owner被剔除或者负载过高时可能选择自身 不是owner时只加载不写入mainCache
+			if !g.owns(key) {
+				g.Stats.FallbackLoads.Add(1)
+				return g.fetchLocally(key)
 			}
 		}
 		return g.getLocally(key)
@@ -170,24 +341,43 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// failover为true表示请求的是后继节点 收到请求的节点不会再转发
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string, failover bool) (ByteView, error) {
 	// bytes,err := peer.Get(g.name,key)
 	// if err != nil{
 	// 	return ByteView{},err
 	// }
 	// return ByteView{b:bytes},nil
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:    g.name,
+		Key:      key,
+		Failover: failover,
 	}
 	// log.Println("this is getFromPeer func ")
 	res := &pb.Response{}
 	// res := &pb.Response{}
 	log.Println("this is getFromPeer func ")
-	err := peer.Get(req, res)
+	start, began := nextVersion(), time.Now()
+	err := peer.Get(ctx, req, res)
 	
 	if err != nil {
-		log.Fatal("ERROR",err)
+		g.hooks.loaded(g.hooks.OnPeerLoad, key, ByteView{}, err, began)
+		return ByteView{}, err
+	}
+	// 使用owner生成的版本号 旧版本节点没有版本号时使用请求开始时的版本号
+	view := ByteView{b: res.Value, c: res.Compression, ver: res.Version, tags: res.Tags, seq: start}
+	if view.ver == 0 {
+		view.ver = start
+	} else {
+		observeVersion(view.ver)
+	}
+	// 使用owner设置的过期时间
+	if res.Expire != 0 {
+		view.e = time.Unix(0, res.Expire)
+	}
+	value, err := g.storageView(view)
+	g.hooks.loaded(g.hooks.OnPeerLoad, key, value, err, began)
+	if err != nil {
 		return ByteView{}, err
 	}
 	// 计算QPS
@@ -197,7 +387,7 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 		qps := stat.remoteCnt.Get() / int64(math.Max(1, math.Round(interval)))
 		if qps >= int64(maxQPS) {
 			// 存入hotcache中
-			g.populateHotCache(key, ByteView{b: res.Value})
+			g.populateHotCache(key, value)
 			//删除映射关系,节省内存
 			mu.Lock()
 			delete(g.keys, key)
@@ -210,24 +400,71 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 			}
 		}
 	}
-	return ByteView{b: res.Value}, nil
+	return value, nil
 }
 func (g *Group) getLocally(key string) (ByteView, error) {
-	// 调用回调方法来获取到数据源
-	bytes, err := g.getter.Get(key)
+	value, err := g.fetchLocally(key)
 	if err != nil {
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
 	// 然后调用方法把key和value传入到缓存中
-	g.populateCache(key, value)
+	// 加载期间key被失效或者写入了更新的值 结果可能是旧值 不写入缓存
+	if !g.populateCache(key, value) {
+		g.Stats.InvalidatedLoads.Add(1)
+		return value, nil
+	}
+	if g.replication != nil {
+		g.replicate(key, value)
+	}
 	return value, nil
 }
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+
+// 从数据源获取数据 返回存储形式的值 不写入缓存
+func (g *Group) fetchLocally(key string) (ByteView, error) {
+	// 版本号在加载开始前生成 加载期间发生的失效和写入的版本号都比它大
+	start := nextVersion()
+	// 调用回调方法来获取到数据源
+	var (
+		bytes []byte
+		tags  []string
+		err   error
+	)
+	began := time.Now()
+	if tg, ok := g.getter.(TaggedGetter); ok {
+		bytes, tags, err = tg.GetTagged(key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
+	g.hooks.loaded(g.hooks.OnLoad, key, ByteView{b: bytes}, err, began)
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		return ByteView{}, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	value := ByteView{b: cloneBytes(bytes), ver: start, tags: tags}
+	if g.ttl > 0 {
+		value.e = time.Now().Add(g.ttl)
+	}
+	// 按配置压缩后再存入缓存 内存占用按压缩后的大小统计
+	if g.compression != nil && g.compression.Storage {
+		value = g.compression.encode(value)
+	}
+	return value, nil
+}
+// 写入mainCache 版本号不大于最近一次失效或者早于缓存中已有的值时不写入
+func (g *Group) populateCache(key string, value ByteView) bool {
+	admit := g.admit(key, value)
+	if value.ver == 0 {
+		value.ver = nextVersion()
+	}
+	return g.mainCache.addIf(key, value, admit)
 }
 
 // populateHotCache 将数据添加到hotCache中
-func (g *Group) populateHotCache(key string, value ByteView) {
-	g.hotCache.add(key, value)
+func (g *Group) populateHotCache(key string, value ByteView) bool {
+	admit := g.admit(key, value)
+	if value.ver == 0 {
+		value.ver = nextVersion()
+	}
+	return g.hotCache.addIf(key, value, admit)
 }
@@ -9,8 +9,11 @@ package gocache
 
 import (
 	"fmt"
+	pb "goCache/gocache/gocachepb"
 	"log"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -59,4 +62,111 @@ func TestGet(t *testing.T) {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 	
-}
\ No newline at end of file
+}
+// 测试压缩 值按压缩后的大小计入缓存容量
+func TestGetCompressed(t *testing.T) {
+	value := strings.Repeat("gocache", 1024)
+	for _, typ := range []pb.Compression{pb.Compression_GZIP, pb.Compression_SNAPPY, pb.Compression_ZSTD} {
+		loads := 0
+		g := NewGroup("compressed-"+typ.String(), 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads++
+				return []byte(value), nil
+			}), WithCompression(CompressionConfig{Type: typ, Threshold: 64, Storage: true, Wire: true}))
+		for i := 0; i < 2; i++ {
+			view, err := g.Get("key")
+			if err != nil || view.String() != value {
+				t.Fatalf("%v: get compressed value failed: %v", typ, err)
+			}
+		}
+		// 未压缩的值超过了缓存容量 只有压缩后才能留在缓存中
+		if loads != 1 {
+			t.Fatalf("%v: compressed value should stay in cache, loads = %d", typ, loads)
+		}
+		wire, err := g.wireView(ByteView{b: []byte(value)})
+		if err != nil || wire.c != typ {
+			t.Fatalf("%v: wire value should be compressed", typ)
+		}
+	}
+}
+
+type score struct {
+	Name  string
+	Score int
+}
+
+// 统计解码次数的编解码器
+type countingCodec[T any] struct {
+	Codec[T]
+	unmarshals int
+}
+
+func (c *countingCodec[T]) Unmarshal(data []byte) (T, error) {
+	c.unmarshals++
+	return c.Codec.Unmarshal(data)
+}
+
+// 测试类型化group 多次Get只解码一次
+func TestTypedGroup(t *testing.T) {
+	for name, codec := range map[string]Codec[score]{
+		"json":    JSONCodec[score]{},
+		"gob":     GobCodec[score]{},
+		"msgpack": MsgpackCodec[score]{},
+	} {
+		c := &countingCodec[score]{Codec: codec}
+		g := NewTypedGroup[score]("typed-"+name, 2<<10, c, TypedGetterFunc[score](
+			func(key string) (score, error) {
+				return score{Name: key, Score: 630}, nil
+			}))
+		for i := 0; i < 3; i++ {
+			v, err := g.Get("Tom")
+			if err != nil || v != (score{Name: "Tom", Score: 630}) {
+				t.Fatalf("%s: typed get failed: %v %v", name, v, err)
+			}
+		}
+		if c.unmarshals != 1 {
+			t.Fatalf("%s: value should be decoded once, got %d", name, c.unmarshals)
+		}
+	}
+
+	// 解码后的对象缓存有单独的容量 底层缓存移除key时一起删除
+	g := NewTypedGroup[score]("typed-decoded", 2<<10, JSONCodec[score]{}, TypedGetterFunc[score](
+		func(key string) (score, error) {
+			return score{Name: key, Score: 630}, nil
+		}), WithDecodedCacheBytes(100))
+	for i := 0; i < 10; i++ {
+		g.Get("k" + strconv.Itoa(i))
+	}
+	if n := g.decoded.Len(); n == 0 || n > 4 || g.Group().mainCache.lru.Len() != 10 {
+		t.Fatalf("decoded cache should use its own budget, got %d entries", n)
+	}
+	g.Group().mainCache.clear()
+	if g.decoded.Len() != 0 {
+		t.Fatalf("evicted keys should be removed from decoded cache")
+	}
+	g.Get("Tom")
+	if g.decoded.Len() != 1 || g.Group().MemoryUsage() != g.Group().mainCache.memoryUsage()+g.decoded.MemoryUsage() {
+		t.Fatalf("decoded objects should be counted in MemoryUsage")
+	}
+	g.Group().Invalidate("Tom")
+	if g.decoded.Len() != 0 {
+		t.Fatalf("invalidated key should be removed from decoded cache")
+	}
+	if d := NewTypedGroup[score]("typed-none", 2<<10, JSONCodec[score]{}, TypedGetterFunc[score](
+		func(key string) (score, error) {
+			return score{Name: key}, nil
+		}), WithDecodedCacheBytes(-1)); d.decoded != nil {
+		t.Fatalf("negative budget should disable decoded cache")
+	} else if v, err := d.Get("Tom"); err != nil || v.Name != "Tom" {
+		t.Fatalf("typed get without decoded cache failed: %v %v", v, err)
+	}
+
+	codec := ProtoCodec[*pb.Request]{}
+	data, err := codec.Marshal(&pb.Request{Group: "scores", Key: "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err := codec.Unmarshal(data); err != nil || req.Key != "Tom" {
+		t.Fatalf("proto codec failed: %v %v", req, err)
+	}
+}
@@ -0,0 +1,216 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"goCache/gocache/consistenthash"
+	gpb "goCache/gocache/gocachepb"
+	"io"
+	"time"
+)
+
+/*
+	哈希环变化时的交接
+	节点加入后 新节点负责的key仍然缓存在原来的owner上 新节点从空缓存开始。
+	Set重建哈希环后 比较新旧两个环 把原来由自身负责、现在由其他节点负责的key
+	通过Transfer流发送给新的owner。发送受带宽和时间限制 超时后剩下的key不再发送。
+	接收方只接受自己负责并且还不在缓存中的key。
+*/
+
+// 交接配置
+type HandoffConfig struct {
+	// 每秒最多发送的字节数 0表示不限制
+	BytesPerSecond int64
+	// 一次交接最长的时间 0表示不限制
+	Timeout time.Duration
+	// 每条消息最多包含的字节数
+	BatchBytes int
+}
+
+// 开启哈希环变化时的交接
+func WithHandoff(cfg HandoffConfig) ServerOption {
+	return func(p *Server) {
+		if cfg.BatchBytes <= 0 {
+			cfg.BatchBytes = 64 << 10
+		}
+		p.handoff = &cfg
+	}
+}
+
+// 一次交接的结果
+type HandoffStats struct {
+	// 发送的条目数和字节数
+	Entries int64
+	Bytes   int64
+	// 新owner写入缓存的条目数
+	Accepted int64
+	// 发送失败的节点数
+	Errors int64
+}
+
+// 交接一个group中的一批key
+type handoffBatch struct {
+	group  string
+	keys   []string
+	values []ByteView
+}
+
+// 把旧环上由自身负责、新环上由其他节点负责的key发送给新的owner
+func (p *Server) handoffKeys(old, cur consistenthash.Placement) HandoffStats {
+	ctx := context.Background()
+	if p.handoff.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.handoff.Timeout)
+		defer cancel()
+	}
+	// 按新owner分组
+	moved := map[string][]*handoffBatch{}
+	now := time.Now()
+	for _, g := range p.groupList() {
+		keys, values := g.mainCache.entries()
+		batches := map[string]*handoffBatch{}
+		for i, key := range keys {
+			if old.Get(key) != p.self || !values[i].fresh(now) {
+				continue
+			}
+			owner := cur.Get(key)
+			if owner == "" || owner == p.self {
+				continue
+			}
+			b, ok := batches[owner]
+			if !ok {
+				b = &handoffBatch{group: g.name}
+				batches[owner] = b
+				moved[owner] = append(moved[owner], b)
+			}
+			b.keys = append(b.keys, key)
+			b.values = append(b.values, values[i])
+		}
+	}
+
+	var stats HandoffStats
+	start := time.Now()
+	for owner, batches := range moved {
+		p.mu.Lock()
+		c, ok := p.clients[owner]
+		p.mu.Unlock()
+		if !ok {
+			continue
+		}
+		t, ok := c.getter.(PeerTransferer)
+		if !ok {
+			p.Log("Peer %s does not support transfer", owner)
+			continue
+		}
+		if err := p.transfer(ctx, t, batches, &stats, start); err != nil {
+			stats.Errors++
+			p.Log("Hand off keys to %s failed: %v", owner, err)
+		}
+	}
+	p.Log("Hand off done: sent %d entries (%d bytes), accepted %d, %d errors",
+		stats.Entries, stats.Bytes, stats.Accepted, stats.Errors)
+	return stats
+}
+
+// 通过一个交接流把batches发送给节点
+func (p *Server) transfer(ctx context.Context, t PeerTransferer, batches []*handoffBatch, stats *HandoffStats, start time.Time) error {
+	stream, err := t.OpenTransfer(ctx)
+	if err != nil {
+		return err
+	}
+	send := func(req *gpb.TransferRequest, size int) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		stats.Entries += int64(len(req.Entries))
+		stats.Bytes += int64(size)
+		// 按已经发送的总字节数限速
+		if rate := p.handoff.BytesPerSecond; rate > 0 {
+			wait := time.Duration(float64(stats.Bytes)/float64(rate)*float64(time.Second)) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		return nil
+	}
+	for _, b := range batches {
+		req := &gpb.TransferRequest{Group: b.group}
+		size := 0
+		for i, key := range b.keys {
+			v := b.values[i]
+			entry := &gpb.Entry{Key: key, Value: v.bytes(), Compression: v.c, Version: v.ver, Tags: v.tags}
+			if !v.e.IsZero() {
+				entry.Expire = v.e.UnixNano()
+			}
+			req.Entries = append(req.Entries, entry)
+			size += len(key) + v.Len()
+			if size >= p.handoff.BatchBytes {
+				if err := send(req, size); err != nil {
+					stream.CloseAndRecv()
+					return err
+				}
+				req = &gpb.TransferRequest{Group: b.group}
+				size = 0
+			}
+		}
+		if len(req.Entries) > 0 {
+			if err := send(req, size); err != nil {
+				stream.CloseAndRecv()
+				return err
+			}
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	stats.Accepted += resp.Accepted
+	return nil
+}
+
+// 实现Transfer接口 接收其他节点交接过来的key
+func (p *Server) Transfer(stream gpb.GroupCache_TransferServer) error {
+	var accepted int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&gpb.TransferResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		g := p.getGroup(req.Group)
+		if g == nil {
+			return fmt.Errorf("No this group %s", req.Group)
+		}
+		now := time.Now()
+		for _, e := range req.Entries {
+			if req.Replica && g.acceptReplica(e, now) || !req.Replica && p.Owns(e.Key) && g.accept(e, now) {
+				accepted++
+			}
+		}
+	}
+}
+
+// 写入交接过来的条目 已经过期、已经在缓存中或者版本早于最近一次失效时不写入
+func (g *Group) accept(e *gpb.Entry, now time.Time) bool {
+	v := ByteView{b: e.Value, c: e.Compression, ver: e.Version, tags: e.Tags}
+	if e.Expire != 0 {
+		v.e = time.Unix(0, e.Expire)
+	}
+	if !v.fresh(now) {
+		return false
+	}
+	if g.mainCache.contains(e.Key) {
+		return false
+	}
+	v, err := g.storageView(v)
+	if err != nil {
+		return false
+	}
+	return g.populateCache(e.Key, v)
+}
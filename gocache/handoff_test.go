@@ -0,0 +1,83 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandoff(t *testing.T) {
+	servers, groups, loads := startCluster(t, []string{"a:1", "b:1", "c:1"}, nil,
+		WithHandoff(HandoffConfig{BytesPerSecond: 1 << 20, Timeout: 5 * time.Second, BatchBytes: 64}))
+	for _, svr := range servers {
+		svr.Set("a:1", "b:1")
+	}
+	// 先在a和b两个节点上缓存所有key
+	var keys []string
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		keys = append(keys, key)
+		if v, err := groups["a:1"].Get(key); err != nil || v.String() != "v"+key {
+			t.Fatalf("get %s: %q %v", key, v.String(), err)
+		}
+	}
+	if loads["c:1"].Get() != 0 {
+		t.Fatalf("c is not in the ring yet")
+	}
+
+	// c加入后 a和b把c负责的key交接给c
+	old := servers["a:1"].peers
+	for _, svr := range servers {
+		svr.Set("a:1", "b:1", "c:1")
+	}
+	var moved []string
+	for _, key := range keys {
+		if old.Get(key) != "c:1" && servers["a:1"].peers.Get(key) == "c:1" {
+			moved = append(moved, key)
+		}
+	}
+	if len(moved) == 0 {
+		t.Fatalf("some keys should move to c")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, key := range moved {
+		for {
+			if v, ok := groups["c:1"].mainCache.get(key); ok {
+				if v.String() != "v"+key {
+					t.Fatalf("unexpected value %q for %s", v.String(), key)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("key %s should be handed off to c", key)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// c直接使用交接过来的值 不需要从数据源加载
+	for _, key := range moved {
+		groups["b:1"].Get(key)
+	}
+	if loads["c:1"].Get() != 0 {
+		t.Fatalf("handed off keys should not be loaded again, got %d loads", loads["c:1"].Get())
+	}
+}
+
+// 交接受时间限制
+func TestHandoffTimeout(t *testing.T) {
+	servers, groups, _ := startCluster(t, []string{"a:2", "b:2"}, nil)
+	a := servers["a:2"]
+	a.Set("a:2")
+	for i := 0; i < 100; i++ {
+		groups["a:2"].Get(strconv.Itoa(i))
+	}
+	old := a.peers
+	a.Set("a:2", "b:2")
+	// 每秒100字节 50毫秒内最多发送一批
+	WithHandoff(HandoffConfig{BytesPerSecond: 100, Timeout: 50 * time.Millisecond, BatchBytes: 10})(a)
+	start := time.Now()
+	stats := a.handoffKeys(old, a.peers)
+	if time.Since(start) > time.Second || stats.Errors != 1 || stats.Entries == 0 || stats.Bytes > 20 {
+		t.Fatalf("hand off should stop after timeout, got %+v in %v", stats, time.Since(start))
+	}
+}
@@ -0,0 +1,196 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	请求对冲
+	owner在对冲延迟内没有返回时，再向哈希环上的下一个节点(没有可用节点时在本地加载)
+	发送一个相同的请求，使用先成功返回的结果并取消另一个请求。
+	对冲延迟取最近peer请求耗时的分位数，从而只对长尾请求进行对冲。
+*/
+
+// 对冲配置
+type HedgingConfig struct {
+	// 使用最近请求耗时的该分位数作为对冲延迟 例如0.95
+	Percentile float64
+	// 对冲延迟的下限和上限 MaxDelay小于等于0表示没有上限
+	// 样本不足时使用MaxDelay 没有上限时使用DefaultHedgeDelay
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// 统计最近多少次请求的耗时
+	Window int
+}
+
+// 计算分位数前至少需要的样本数量
+const minHedgeSamples = 10
+
+// 样本不足并且没有配置MaxDelay时使用的对冲延迟
+const DefaultHedgeDelay = 50 * time.Millisecond
+
+// 开启请求对冲
+func WithHedging(cfg HedgingConfig) GroupOption {
+	return func(g *Group) {
+		if cfg.Window < minHedgeSamples {
+			cfg.Window = 100
+		}
+		g.hedging = &hedger{cfg: cfg, latency: newLatencyTracker(cfg.Window)}
+	}
+}
+
+type hedger struct {
+	cfg     HedgingConfig
+	latency *latencyTracker
+}
+
+// 当前的对冲延迟
+func (h *hedger) delay() time.Duration {
+	d, ok := h.latency.percentile(h.cfg.Percentile)
+	if !ok {
+		d = DefaultHedgeDelay
+	}
+	if h.cfg.MaxDelay > 0 && (!ok || d > h.cfg.MaxDelay) {
+		return h.cfg.MaxDelay
+	}
+	if d < h.cfg.MinDelay {
+		return h.cfg.MinDelay
+	}
+	return d
+}
+
+// 记录最近若干次请求的耗时
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int
+}
+
+func newLatencyTracker(window int) *latencyTracker {
+	return &latencyTracker{samples: make([]time.Duration, window)}
+}
+
+func (t *latencyTracker) add(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % len(t.samples)
+	if t.count < len(t.samples) {
+		t.count++
+	}
+}
+
+// 返回耗时的p分位数 样本不足时ok为false
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	if t.count < minHedgeSamples {
+		t.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, t.count)
+	copy(sorted, t.samples[:t.count])
+	t.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i], true
+}
+
+type hedgeResult struct {
+	value ByteView
+	err   error
+	// 是否是对冲请求的结果
+	hedge bool
+}
+
+// 结果是否可以直接返回 NOT_FOUND是owner确认的结果 不需要等待对冲请求
+func (r hedgeResult) final() bool {
+	return r.err == nil || errors.Is(r.err, ErrNotFound)
+}
+
+// 请求owner 超过对冲延迟没有返回时发送对冲请求
+func (g *Group) getHedged(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	results := make(chan hedgeResult, 2)
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	start := time.Now()
+	go func() {
+		value, err := g.getFromPeer(primaryCtx, peer, key, false)
+		if err == nil {
+			g.hedging.latency.add(time.Since(start))
+		}
+		results <- hedgeResult{value: value, err: err}
+	}()
+
+	timer := time.NewTimer(g.hedging.delay())
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		return res.value, res.err
+	case <-timer.C:
+	}
+
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	g.Stats.HedgedRequests.Add(1)
+	hedgeStart := time.Now()
+	remote := g.startHedge(hedgeCtx, key, results)
+
+	first := <-results
+	if !first.final() {
+		// 先返回的请求失败了 等待另一个请求
+		second := <-results
+		if second.final() || first.hedge {
+			first = second
+		}
+	} else if first.hedge {
+		// owner的请求将被取消 已等待的时间作为截尾样本记录
+		// 否则慢请求总是被取消 分位数只包含快请求 对冲延迟会越来越小
+		g.hedging.latency.add(time.Since(start))
+	} else if remote {
+		g.hedging.latency.add(time.Since(hedgeStart))
+	}
+	if first.hedge && first.err == nil {
+		g.Stats.HedgeWins.Add(1)
+	}
+	// 返回后通过defer取消另一个还没有完成的请求
+	return first.value, first.err
+}
+
+// 向下一个节点发送对冲请求 没有可用节点时在本地加载
+// 返回对冲请求是否发给了其他节点
+func (g *Group) startHedge(ctx context.Context, key string, results chan<- hedgeResult) bool {
+	local := false
+	if picker, ok := g.peers.(FailoverPicker); ok {
+		var peers []PeerGetter
+		peers, local = picker.PickFailover(key, 1)
+		if len(peers) > 0 {
+			go func() {
+				start := time.Now()
+				value, err := g.getFromPeer(ctx, peers[0], key, true)
+				if err == nil {
+					g.hedging.latency.add(time.Since(start))
+				}
+				results <- hedgeResult{value: value, err: err, hedge: true}
+			}()
+			return true
+		}
+	}
+	go func() {
+		// 当前节点是下一个负责该key的节点时写入缓存 否则只加载不缓存
+		load := g.fetchLocally
+		if local {
+			load = g.getLocally
+		}
+		value, err := load(key)
+		results <- hedgeResult{value: value, err: err, hedge: true}
+	}()
+	return false
+}
@@ -0,0 +1,79 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	owner := &fakePeer{value: "owner", delay: time.Second}
+	successor := &fakePeer{value: "successor"}
+	g := NewGroup("hedging", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithHedging(HedgingConfig{Percentile: 0.95, MaxDelay: 20 * time.Millisecond}))
+	g.RegisterPeers(&fakePicker{owner: owner, replicas: []PeerGetter{successor}})
+
+	// owner超过对冲延迟没有返回 使用后继节点的结果并取消owner的请求
+	start := time.Now()
+	if view, err := g.Get("k1"); err != nil || view.String() != "successor" {
+		t.Fatalf("hedged request should win, got %q %v", view.String(), err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("hedged get should not wait for the slow owner")
+	}
+	if g.Stats.HedgedRequests.Get() != 1 || g.Stats.HedgeWins.Get() != 1 {
+		t.Fatalf("unexpected hedge stats %+v", g.Stats)
+	}
+	deadline := time.Now().Add(time.Second)
+	for owner.canceled.Get() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if owner.canceled.Get() != 1 {
+		t.Fatalf("slow owner request should be cancelled")
+	}
+	// 被取消的owner请求耗时也作为样本记录 另一个样本是后继节点的请求
+	censored := func() bool {
+		l := g.hedging.latency
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.count == 2 && (l.samples[0] >= 20*time.Millisecond || l.samples[1] >= 20*time.Millisecond)
+	}
+	for !censored() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !censored() {
+		t.Fatalf("cancelled request should be recorded as a censored sample")
+	}
+
+	// owner及时返回时不发送对冲请求
+	owner.delay = 0
+	if view, err := g.Get("k2"); err != nil || view.String() != "owner" {
+		t.Fatalf("owner should answer, got %q %v", view.String(), err)
+	}
+	if g.Stats.HedgedRequests.Get() != 1 || successor.calls.Get() != 1 {
+		t.Fatalf("fast owner should not be hedged")
+	}
+
+	// 样本足够后使用分位数作为对冲延迟 之前的截尾样本不超过5%
+	for i := 0; i < 5*minHedgeSamples; i++ {
+		g.hedging.latency.add(time.Millisecond)
+	}
+	if d := g.hedging.delay(); d != time.Millisecond {
+		t.Fatalf("hedge delay should follow latency percentile, got %v", d)
+	}
+}
+
+// 没有上限时样本不足使用默认延迟 样本足够后不限制分位数
+func TestHedgingNoMaxDelay(t *testing.T) {
+	h := &hedger{cfg: HedgingConfig{Percentile: 0.5}, latency: newLatencyTracker(100)}
+	if d := h.delay(); d != DefaultHedgeDelay {
+		t.Fatalf("expected default hedge delay before samples, got %v", d)
+	}
+	for i := 0; i < minHedgeSamples; i++ {
+		h.latency.add(time.Second)
+	}
+	if d := h.delay(); d != time.Second {
+		t.Fatalf("MaxDelay 0 should not cap hedge delay, got %v", d)
+	}
+}
@@ -0,0 +1,98 @@
+package gocache
+
+import (
+	"goCache/gocache/lru"
+	"time"
+)
+
+/*
+	生命周期钩子
+	用于写回、审计日志和指标等 所有钩子都在不持有缓存锁的时候调用 钩子中可以访问Group
+	钩子在请求的goroutine中同步调用 耗时的处理应该交给其他goroutine
+	传给钩子的值都是解压后的原始数据
+*/
+
+// 缓存被移除的原因
+type EvictReason = lru.EvictReason
+
+const (
+	// 已经过期 过期的值被重新加载的值替换
+	EvictExpired = lru.EvictExpired
+	// 超过容量被淘汰
+	EvictCapacity = lru.EvictCapacity
+	// 被失效或者删除
+	EvictExplicit = lru.EvictExplicit
+	// 被新的值替换
+	EvictReplaced = lru.EvictReplaced
+)
+
+// Group的钩子 为nil的钩子不调用
+type Hooks struct {
+	// 值从mainCache中移除或者被替换时调用 替换时value是旧值
+	// hotCache中是其他节点负责的key的副本 不调用
+	OnEvict func(key string, value ByteView, reason EvictReason)
+	// 从本地数据源加载之后调用 err不为nil时value为空
+	OnLoad func(key string, value ByteView, err error, took time.Duration)
+	// 从其他节点获取之后调用 包括故障转移的请求
+	OnPeerLoad func(key string, value ByteView, err error, took time.Duration)
+	// 缓存命中时调用 包括返回过期值并在后台刷新的情况
+	OnHit func(key string)
+	// 缓存未命中或者值已经过期需要重新加载时调用
+	OnMiss func(key string)
+}
+
+// 注册钩子
+func WithHooks(h Hooks) GroupOption {
+	return func(g *Group) {
+		g.hooks = h
+	}
+}
+
+func (h *Hooks) hit(key string) {
+	if h.OnHit != nil {
+		h.OnHit(key)
+	}
+}
+
+func (h *Hooks) miss(key string) {
+	if h.OnMiss != nil {
+		h.OnMiss(key)
+	}
+}
+
+// 调用OnLoad或者OnPeerLoad value是存储形式的值
+func (h *Hooks) loaded(fn func(string, ByteView, error, time.Duration), key string, value ByteView, err error, start time.Time) {
+	if fn == nil {
+		return
+	}
+	took := time.Since(start)
+	if err == nil {
+		value, err = decode(value)
+	}
+	if err != nil {
+		value = ByteView{}
+	}
+	fn(key, value, err, took)
+}
+
+// mainCache移除值之后 在释放锁后调用
+func (g *Group) evicted(key string, value ByteView, reason EvictReason) {
+	if g.derived != nil {
+		g.derived.forget(key)
+	}
+	if g.hooks.OnEvict == nil {
+		return
+	}
+	v, err := decode(value)
+	if err != nil {
+		v = value
+	}
+	g.hooks.OnEvict(key, v, reason)
+}
+
+// 被移除的值 释放锁后再通知
+type evictEvent struct {
+	key    string
+	value  ByteView
+	reason EvictReason
+}
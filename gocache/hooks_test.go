@@ -0,0 +1,116 @@
+package gocache
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录钩子的调用
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *hookRecorder) add(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *hookRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func TestHooks(t *testing.T) {
+	rec := &hookRecorder{}
+	var g *Group
+	g = NewGroup("hooks", 20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("v" + key), nil
+	}), WithTTL(50*time.Millisecond), WithHooks(Hooks{
+		OnEvict: func(key string, value ByteView, reason EvictReason) {
+			// 调用时不持有锁 可以访问缓存
+			g.mainCache.contains(key)
+			rec.add("evict " + key + "=" + value.String() + " " + reason.String())
+		},
+		OnLoad: func(key string, value ByteView, err error, took time.Duration) {
+			if err != nil {
+				rec.add("load " + key + " error")
+				return
+			}
+			rec.add("load " + key + "=" + value.String())
+		},
+		OnHit:  func(key string) { rec.add("hit " + key) },
+		OnMiss: func(key string) { rec.add("miss " + key) },
+	}))
+
+	g.Get("k1")
+	g.Get("k1")
+	g.Get("missing")
+	if got, want := rec.take(), []string{"miss k1", "load k1=vk1", "hit k1", "miss missing", "load missing error"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+
+	// 每个值占用5字节 超过20字节时淘汰最久未访问的k1
+	for i := 2; i <= 4; i++ {
+		g.Get("k" + strconv.Itoa(i))
+	}
+	rec.take()
+	g.Get("k5")
+	if got := rec.take(); !reflect.DeepEqual(got[len(got)-1], "evict k1=vk1 capacity") {
+		t.Fatalf("expected capacity eviction, got %v", got)
+	}
+
+	g.Invalidate("k5")
+	if _, err := g.CompareAndSet("k4", []byte("new"), 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("CompareAndSet with version 0 on existing key should fail")
+	}
+	_, ver, _ := g.GetWithVersion("k4")
+	g.CompareAndSet("k4", []byte("new"), ver)
+	got := rec.take()
+	if got[0] != "evict k5=vk5 explicit" || got[len(got)-1] != "evict k4=vk4 replaced" {
+		t.Fatalf("expected explicit and replaced evictions, got %v", got)
+	}
+
+	// 过期的值被重新加载的值替换
+	time.Sleep(60 * time.Millisecond)
+	g.Get("k3")
+	if got := rec.take(); !reflect.DeepEqual(got, []string{"miss k3", "load k3=vk3", "evict k3=vk3 expired"}) {
+		t.Fatalf("expected expired eviction, got %v", got)
+	}
+}
+
+func TestPeerLoadHook(t *testing.T) {
+	addrs := []string{"a:6", "b:6"}
+	rec := &hookRecorder{}
+	servers, groups, _ := startCluster(t, addrs, []GroupOption{WithHooks(Hooks{
+		OnPeerLoad: func(key string, value ByteView, err error, took time.Duration) {
+			rec.add(key + "=" + value.String())
+		},
+	})})
+	for _, svr := range servers {
+		svr.Set(addrs...)
+	}
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := "k" + strconv.Itoa(i); !servers["a:6"].Owns(k) {
+			key = k
+		}
+	}
+	if _, err := groups["a:6"].Get(key); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.take(); !reflect.DeepEqual(got, []string{key + "=v" + key}) {
+		t.Fatalf("peer load events = %v", got)
+	}
+}
@@ -0,0 +1,384 @@
+package gocache
+
+import (
+	"context"
+	gpb "goCache/gocache/gocachepb"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+	集群范围的失效
+	Invalidate先删除当前节点的mainCache和hotCache 再通过Server广播给所有节点。
+	可以失效单个key、以某个前缀开头的key或者带有某个标签的key 前缀和标签通过cache中的索引查找。
+	  - 至少一次: 发送失败的通知保存在队列中 定期重试 直到成功或者超过MaxAge
+	  - 版本号: 每次失效使用一个混合逻辑时钟的版本号(unix纳秒 保证单调递增)
+	  - 墓碑: 节点为失效的key保留一段时间的墓碑 收到通知时用本地时钟生成一个序号记录在墓碑中
+	    本地开始的加载和请求使用开始时的本地序号和墓碑比较 早于墓碑时不写入缓存
+	    这样发送方的时钟落后时 失效之前开始的加载也不会让旧值复活
+	  - 重复或者乱序到达的旧通知 发送方的版本号不大于已有墓碑 直接忽略
+	其他节点推送的副本和交接的值只有owner的版本号 时钟偏差超过加载耗时的时候仍然可能被写入。
+*/
+
+// 墓碑默认保留的时间
+const defaultTombstoneTTL = time.Minute
+
+// 混合逻辑时钟 最近一次生成或者收到的版本号
+var lastVersion uint64
+
+// 生成一个新的版本号 不小于当前时间 并且大于之前所有的版本号
+func nextVersion() uint64 {
+	for {
+		last := atomic.LoadUint64(&lastVersion)
+		v := uint64(time.Now().UnixNano())
+		if v <= last {
+			v = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&lastVersion, last, v) {
+			return v
+		}
+	}
+}
+
+// 收到其他节点的版本号 之后生成的版本号都大于它
+func observeVersion(v uint64) {
+	for {
+		last := atomic.LoadUint64(&lastVersion)
+		if v <= last || atomic.CompareAndSwapUint64(&lastVersion, last, v) {
+			return
+		}
+	}
+}
+
+// 设置墓碑保留的时间
+func WithTombstoneTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.tombstones.ttl = ttl
+	}
+}
+
+// 失效的范围
+type scope int
+
+const (
+	scopeKey scope = iota
+	scopePrefix
+	scopeTag
+)
+
+// 失效通知的范围
+func requestScope(in *gpb.InvalidateRequest) scope {
+	switch {
+	case in.Tag:
+		return scopeTag
+	case in.Prefix:
+		return scopePrefix
+	}
+	return scopeKey
+}
+
+// 一个墓碑
+type tombstone struct {
+	// 发送方的版本号 用于忽略重复和乱序的通知
+	version uint64
+	// 收到通知时本地生成的序号 用于判断值是否是失效之前加载的
+	seq uint64
+}
+
+// 失效的key、前缀和标签的墓碑
+type tombstones struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	keys     map[string]tombstone
+	prefixes map[string]tombstone
+	tags     map[string]tombstone
+}
+
+func newTombstones(ttl time.Duration) *tombstones {
+	return &tombstones{ttl: ttl, keys: map[string]tombstone{}, prefixes: map[string]tombstone{}, tags: map[string]tombstone{}}
+}
+
+// 添加墓碑 版本号不大于已有墓碑时返回false
+func (t *tombstones) add(key string, s scope, version uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gc()
+	m := t.keys
+	switch s {
+	case scopePrefix:
+		m = t.prefixes
+	case scopeTag:
+		m = t.tags
+	}
+	if version <= m[key].version {
+		return false
+	}
+	// 调用前已经observeVersion 本地序号大于发送方的版本号和之前开始的所有加载
+	m[key] = tombstone{version: version, seq: nextVersion()}
+	return true
+}
+
+// 返回带有tags的key最新的失效序号 没有墓碑时返回0
+func (t *tombstones) latest(key string, tags []string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v := t.keys[key].seq
+	for prefix, p := range t.prefixes {
+		if p.seq > v && strings.HasPrefix(key, prefix) {
+			v = p.seq
+		}
+	}
+	for _, tag := range tags {
+		if ts := t.tags[tag].seq; ts > v {
+			v = ts
+		}
+	}
+	return v
+}
+
+// 删除超过保留时间的墓碑 调用时需要持有锁
+func (t *tombstones) gc() {
+	expired := uint64(time.Now().Add(-t.ttl).UnixNano())
+	for _, m := range []map[string]tombstone{t.keys, t.prefixes, t.tags} {
+		for key, ts := range m {
+			if ts.seq < expired {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// 使key在整个集群中失效
+func (g *Group) Invalidate(key string) {
+	g.invalidate(key, scopeKey)
+}
+
+// 使所有以prefix开头的key在整个集群中失效
+func (g *Group) InvalidatePrefix(prefix string) {
+	g.invalidate(prefix, scopePrefix)
+}
+
+// 使所有带有tag标签的key在整个集群中失效 标签由TaggedGetter返回
+func (g *Group) InvalidateTag(tag string) {
+	g.invalidate(tag, scopeTag)
+}
+
+func (g *Group) invalidate(key string, s scope) {
+	version := nextVersion()
+	g.applyInvalidation(key, s, version)
+	if pub, ok := g.peers.(InvalidationPublisher); ok {
+		pub.PublishInvalidation(&gpb.InvalidateRequest{
+			Group:   g.name,
+			Key:     key,
+			Prefix:  s == scopePrefix,
+			Tag:     s == scopeTag,
+			Version: version,
+		})
+	}
+}
+
+// 删除当前节点的缓存并记录墓碑 重复的旧通知返回false
+func (g *Group) applyInvalidation(key string, s scope, version uint64) bool {
+	observeVersion(version)
+	if !g.tombstones.add(key, s, version) {
+		return false
+	}
+	switch s {
+	case scopePrefix:
+		g.mainCache.removePrefix(key)
+		g.hotCache.removePrefix(key)
+	case scopeTag:
+		g.mainCache.removeTag(key)
+		g.hotCache.removeTag(key)
+	default:
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+	}
+	g.Stats.Invalidations.Add(1)
+	return true
+}
+
+// 返回判断value能否写入缓存的函数 在cache的锁内调用
+// 开始请求时的本地序号不大于墓碑时 说明值是失效或者写入之前加载的 不能写入
+// 没有本地序号时使用版本号 版本号未知的值只在没有墓碑时写入
+func (g *Group) admit(key string, value ByteView) func(old ByteView, ok bool) bool {
+	return func(old ByteView, ok bool) bool {
+		latest := g.tombstones.latest(key, value.tags)
+		seq := value.seq
+		if seq == 0 {
+			seq = value.ver
+		}
+		if seq == 0 {
+			return latest == 0
+		}
+		return seq > latest && (!ok || value.ver >= old.ver)
+	}
+}
+
+// 可以接收失效通知的PeerGetter
+type PeerInvalidator interface {
+	Invalidate(ctx context.Context, in *gpb.InvalidateRequest) error
+}
+
+// 可以向所有节点广播失效通知的PeerPicker
+type InvalidationPublisher interface {
+	PublishInvalidation(req *gpb.InvalidateRequest)
+}
+
+// 失效通知的重试配置
+type InvalidationConfig struct {
+	// 重试发送失败通知的间隔
+	RetryInterval time.Duration
+	// 通知发出超过该时间后不再重试 应不小于墓碑保留时间
+	MaxAge time.Duration
+}
+
+// 默认的失效通知重试配置
+var DefaultInvalidationConfig = InvalidationConfig{
+	RetryInterval: time.Second,
+	MaxAge:        defaultTombstoneTTL,
+}
+
+// 设置失效通知的重试配置
+func WithInvalidation(cfg InvalidationConfig) ServerOption {
+	return func(p *Server) {
+		p.invalidation = cfg
+	}
+}
+
+// 发送失败等待重试的失效通知
+type invalidationQueue struct {
+	mu      sync.Mutex
+	pending map[string][]*gpb.InvalidateRequest
+	stop    chan struct{}
+	// 停止后不再发送和重试通知
+	stopped bool
+}
+
+// 是否已经停止
+func (q *invalidationQueue) isStopped() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stopped
+}
+
+// 实现InvalidationPublisher 向除自身以外的所有节点发送通知
+func (p *Server) PublishInvalidation(req *gpb.InvalidateRequest) {
+	if p.invalidations.isStopped() {
+		return
+	}
+	req.Origin = p.self
+	p.mu.Lock()
+	peers := make([]string, 0, len(p.clients))
+	for peer := range p.clients {
+		if peer != p.self {
+			peers = append(peers, peer)
+		}
+	}
+	p.mu.Unlock()
+	for _, peer := range peers {
+		go func(peer string) {
+			if err := p.sendInvalidation(peer, req); err != nil {
+				p.Log("Send invalidation %s/%s to %s failed: %v", req.Group, req.Key, peer, err)
+				p.enqueueInvalidation(peer, req)
+			}
+		}(peer)
+	}
+}
+
+// 向节点发送一个通知
+func (p *Server) sendInvalidation(peer string, req *gpb.InvalidateRequest) error {
+	p.mu.Lock()
+	c, ok := p.clients[peer]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	inv, ok := c.getter.(PeerInvalidator)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPeerTimeout)
+	defer cancel()
+	return inv.Invalidate(ctx, req)
+}
+
+func (p *Server) enqueueInvalidation(peer string, req *gpb.InvalidateRequest) {
+	q := &p.invalidations
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return
+	}
+	if q.pending == nil {
+		q.pending = map[string][]*gpb.InvalidateRequest{}
+	}
+	q.pending[peer] = append(q.pending[peer], req)
+	if q.stop == nil {
+		q.stop = make(chan struct{})
+		go p.retryInvalidations(q.stop)
+	}
+}
+
+// 定期重试发送失败的通知
+func (p *Server) retryInvalidations(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.invalidation.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		q := &p.invalidations
+		q.mu.Lock()
+		pending := q.pending
+		q.pending = map[string][]*gpb.InvalidateRequest{}
+		q.mu.Unlock()
+		expired := uint64(time.Now().Add(-p.invalidation.MaxAge).UnixNano())
+		for peer, reqs := range pending {
+			for i, req := range reqs {
+				if req.Version < expired {
+					log.Printf("[gocache] drop invalidation %s/%s to %s after %v", req.Group, req.Key, peer, p.invalidation.MaxAge)
+					continue
+				}
+				if err := p.sendInvalidation(peer, req); err != nil {
+					// 保持顺序 剩下的通知下次再发送
+					for _, req := range reqs[i:] {
+						p.enqueueInvalidation(peer, req)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// 停止重试
+func (p *Server) stopInvalidations() {
+	q := &p.invalidations
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopped = true
+	q.pending = nil
+	if q.stop != nil {
+		close(q.stop)
+		q.stop = nil
+	}
+}
+
+// 实现Invalidate接口 接收其他节点的失效通知
+func (p *Server) Invalidate(ctx context.Context, in *gpb.InvalidateRequest) (*gpb.InvalidateResponse, error) {
+	g := p.getGroup(in.Group)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "No this group %s", in.Group)
+	}
+	g.applyInvalidation(in.Key, requestScope(in), in.Version)
+	return &gpb.InvalidateResponse{}, nil
+}
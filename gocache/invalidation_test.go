@@ -0,0 +1,203 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	gpb "goCache/gocache/gocachepb"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 前几次发送失效通知失败的节点
+type flakyPeer struct {
+	bufPeer
+	failures AtomicInt
+}
+
+func (p *flakyPeer) Invalidate(ctx context.Context, in *gpb.InvalidateRequest) error {
+	if p.failures.Get() > 0 {
+		p.failures.Add(-1)
+		return errors.New("unavailable")
+	}
+	return p.bufPeer.Invalidate(ctx, in)
+}
+
+// 等待条件成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	addrs := []string{"a:4", "b:4", "c:4"}
+	servers, groups, _ := startCluster(t, addrs, nil, WithInvalidation(InvalidationConfig{
+		RetryInterval: 10 * time.Millisecond,
+		MaxAge:        time.Minute,
+	}))
+	for _, svr := range servers {
+		svr.Set(addrs...)
+		defer svr.stopInvalidations()
+	}
+	// 每个节点都缓存了旧值
+	for _, g := range groups {
+		g.populateCache("user:1", StringView("old"))
+		g.populateHotCache("user:2", StringView("old"))
+		g.populateCache("order:1", StringView("old"))
+	}
+	cached := func(g *Group, key string) bool {
+		_, hot, ok := g.lookupCache(key)
+		return ok || hot
+	}
+
+	// 第一次发送给b失败 重试后送达
+	flaky := &flakyPeer{bufPeer: servers["a:4"].clients["b:4"].getter.(bufPeer)}
+	flaky.failures.Add(1)
+	servers["a:4"].clients["b:4"].getter = flaky
+	groups["a:4"].Invalidate("user:1")
+	if cached(groups["a:4"], "user:1") {
+		t.Fatalf("local cache should be invalidated immediately")
+	}
+	for _, addr := range []string{"b:4", "c:4"} {
+		g := groups[addr]
+		waitFor(t, "user:1 invalidated on "+addr, func() bool { return !cached(g, "user:1") })
+	}
+
+	// 前缀失效同时删除hotCache中的副本
+	groups["c:4"].InvalidatePrefix("user:")
+	for _, g := range groups {
+		g := g
+		waitFor(t, "user: prefix invalidated", func() bool { return !cached(g, "user:2") })
+		if !cached(g, "order:1") {
+			t.Fatalf("keys without the prefix should be kept")
+		}
+	}
+
+	// 重复的旧通知被忽略
+	b := groups["b:4"]
+	n := b.Stats.Invalidations.Get()
+	if b.applyInvalidation("user:1", scopeKey, 1) || b.Stats.Invalidations.Get() != n {
+		t.Fatalf("old invalidation should be ignored")
+	}
+
+	// 停止后不再发送和重试通知
+	a := servers["a:4"]
+	a.stopInvalidations()
+	a.enqueueInvalidation("b:4", &gpb.InvalidateRequest{Group: "cluster", Key: "order:1"})
+	a.PublishInvalidation(&gpb.InvalidateRequest{Group: "cluster", Key: "order:1", Version: nextVersion()})
+	time.Sleep(50 * time.Millisecond)
+	if a.invalidations.pending != nil || !cached(b, "order:1") {
+		t.Fatalf("stopped server should drop invalidations")
+	}
+}
+
+// 加载期间被失效时 结果不写入缓存
+func TestInvalidationDuringLoad(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("invalidate-load", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			entered <- struct{}{}
+			<-release
+			return []byte("old"), nil
+		}))
+	done := make(chan struct{})
+	go func() {
+		g.Get("k")
+		close(done)
+	}()
+	<-entered
+	g.Invalidate("k")
+	close(release)
+	<-done
+	if _, ok := g.mainCache.get("k"); ok || g.Stats.InvalidatedLoads.Get() != 1 {
+		t.Fatalf("load started before invalidation should not be cached")
+	}
+	// 副本和交接的值同样不接受
+	if g.acceptReplica(&gpb.Entry{Key: "k", Value: []byte("old")}, time.Now()) {
+		t.Fatalf("replica of invalidated key should be rejected")
+	}
+	// 失效之后开始的加载正常写入
+	go func() { <-entered; close(done) }()
+	release = make(chan struct{})
+	close(release)
+	done = make(chan struct{})
+	g.Get("k")
+	<-done
+	if _, ok := g.mainCache.get("k"); !ok {
+		t.Fatalf("load started after invalidation should be cached")
+	}
+
+	// 发送方的时钟落后时 失效之前开始的加载同样不写入缓存
+	done = make(chan struct{})
+	release = make(chan struct{})
+	go func() {
+		g.Get("k2")
+		close(done)
+	}()
+	<-entered
+	if !g.applyInvalidation("k2", scopeKey, uint64(time.Now().Add(-100*time.Millisecond).UnixNano())) {
+		t.Fatalf("first invalidation of k2 should apply")
+	}
+	close(release)
+	<-done
+	if _, ok := g.mainCache.get("k2"); ok {
+		t.Fatalf("load started before a skewed invalidation should not be cached")
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	// user:42:profile带有标签user:42
+	getter := TaggedGetterFunc(func(key string) ([]byte, []string, error) {
+		parts := strings.SplitN(key, ":", 3)
+		return []byte("v" + key), []string{parts[0] + ":" + parts[1]}, nil
+	})
+	g := NewGroup("invalidate-tag", 0, getter)
+	for _, key := range []string{"user:42:profile", "user:42:orders", "user:43:profile", "user:420:profile"} {
+		g.Get(key)
+	}
+	g.InvalidateTag("user:42")
+	for key, want := range map[string]bool{"user:42:profile": false, "user:42:orders": false, "user:43:profile": true, "user:420:profile": true} {
+		if _, ok := g.mainCache.get(key); ok != want {
+			t.Fatalf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+	// 之后不再接受失效之前加载的值
+	if g.acceptReplica(&gpb.Entry{Key: "user:42:profile", Value: []byte("old"), Version: 1, Tags: []string{"user:42"}}, time.Now()) {
+		t.Fatalf("replica with invalidated tag should be rejected")
+	}
+	g.InvalidatePrefix("user:4")
+	if keys, _ := g.mainCache.entries(); len(keys) != 0 {
+		t.Fatalf("prefix invalidation left %v", keys)
+	}
+}
+
+// 淘汰和替换时清理索引
+func TestCacheIndex(t *testing.T) {
+	c := cache{cacheBytes: 30}
+	for i := 0; i < 10; i++ {
+		key := "k" + strconv.Itoa(i)
+		c.add(key, ByteView{s: "12345678", tags: []string{"t" + strconv.Itoa(i%2)}})
+	}
+	c.add("k9", ByteView{s: "1", tags: []string{"t2"}})
+	if c.sorted.len != c.lru.Len() {
+		t.Fatalf("sorted index has %d keys, cache has %d", c.sorted.len, c.lru.Len())
+	}
+	indexed := 0
+	for _, keys := range c.tagged {
+		indexed += len(keys)
+	}
+	// 只剩下k7 k8 k9 k9替换后不再带有标签t1
+	if _, stale := c.tagged["t1"]["k9"]; stale || indexed != c.lru.Len() || len(c.tagged["t2"]) != 1 {
+		t.Fatalf("tag index not cleaned: %v", c.tagged)
+	}
+	if n := c.removeTag("t2"); n != 1 || c.lru.Len() != c.sorted.len {
+		t.Fatalf("removeTag removed %d", n)
+	}
+}
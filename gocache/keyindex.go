@@ -0,0 +1,88 @@
+package gocache
+
+import "math/rand"
+
+/*
+	有序的key索引 使用跳表实现
+	插入和删除的时间复杂度为O(log n) 可以从任意位置开始按顺序遍历 用于按前缀查找key
+	不是并发安全的 由cache的锁保护
+*/
+
+// 跳表的最大层数 每个节点以1/4的概率升高一层
+const maxIndexLevel = 24
+
+type indexNode struct {
+	key  string
+	next []*indexNode
+}
+
+type keyIndex struct {
+	head  indexNode
+	level int
+	len   int
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{head: indexNode{next: make([]*indexNode, maxIndexLevel)}, level: 1}
+}
+
+// 返回第一个不小于key的节点 update中记录每一层最后一个小于key的节点
+func (s *keyIndex) search(key string, update []*indexNode) *indexNode {
+	x := &s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+// 插入key 已经存在时不做处理
+func (s *keyIndex) insert(key string) {
+	var update [maxIndexLevel]*indexNode
+	if n := s.search(key, update[:]); n != nil && n.key == key {
+		return
+	}
+	level := 1
+	for level < maxIndexLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	for ; s.level < level; s.level++ {
+		update[s.level] = &s.head
+	}
+	n := &indexNode{key: key, next: make([]*indexNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	s.len++
+}
+
+// 删除key 不存在时返回false
+func (s *keyIndex) delete(key string) bool {
+	var update [maxIndexLevel]*indexNode
+	n := s.search(key, update[:])
+	if n == nil || n.key != key {
+		return false
+	}
+	for i := range n.next {
+		update[i].next[i] = n.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.len--
+	return true
+}
+
+// 从第一个不小于from的key开始按顺序遍历 fn返回false时停止
+func (s *keyIndex) ascend(from string, fn func(key string) bool) {
+	for n := s.search(from, nil); n != nil; n = n.next[0] {
+		if !fn(n.key) {
+			return
+		}
+	}
+}
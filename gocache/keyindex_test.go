@@ -0,0 +1,46 @@
+package gocache
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	s := newKeyIndex()
+	want := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		key := "k" + strconv.Itoa(rand.Intn(500))
+		if rand.Intn(3) == 0 {
+			s.delete(key)
+			delete(want, key)
+		} else {
+			s.insert(key)
+			want[key] = true
+		}
+	}
+	var keys, got []string
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s.ascend("", func(key string) bool {
+		got = append(got, key)
+		return true
+	})
+	if s.len != len(keys) || !reflect.DeepEqual(got, keys) {
+		t.Fatalf("index has %d keys, want %d", s.len, len(keys))
+	}
+	// 从中间开始遍历 fn返回false时停止
+	got = got[:0]
+	s.ascend("k2", func(key string) bool {
+		got = append(got, key)
+		return len(got) < 3
+	})
+	i := sort.SearchStrings(keys, "k2")
+	if !reflect.DeepEqual(got, keys[i:i+3]) {
+		t.Fatalf("ascend from k2 = %v, want %v", got, keys[i:i+3])
+	}
+}
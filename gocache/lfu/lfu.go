@@ -3,6 +3,8 @@ package lfu
 import (
 	"container/heap"
 	"log"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -15,18 +17,50 @@ type LFUCache struct{
 	maxBytes int64
 	// 已使用容量 
 	nBytes int64
+	// 每个条目除了key和value之外额外计算的字节数 
+	overhead int64
 	// 使用最小堆来实现按使用频率排序 
 	heap *entryHeap
 	// map 
 	cache map[string]*entry
-	// 删除时的回调函数 
+	// 删除时的回调函数 替换旧值时不调用
 	OnEvicted  func(key string, value Value)
+	// 带有删除原因的回调函数 替换旧值时也会调用 参数为旧值
+	OnEvictedReason func(key string, value Value, reason EvictReason)
 	// 默认过期时间 
 	defaultTTL time.Duration
 }
 type Value interface{
 	Len() int
 } 
+
+// 缓存被删除的原因
+type EvictReason int
+
+const (
+	// 已经过期
+	EvictExpired EvictReason = iota
+	// 超过容量被淘汰
+	EvictCapacity
+	// 调用Remove或者Clear删除
+	EvictExplicit
+	// 被新的值替换
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictExplicit:
+		return "explicit"
+	case EvictReplaced:
+		return "replaced"
+	}
+	return "unknown"
+}
 // 实现entry
 type entry struct{
 	key string 
@@ -77,7 +111,7 @@ func (c *LFUCache)Get(key string)(value Value,ok bool){
 		// 1 查看是否过期 
 		if ele.expire.Before(time.Now()){
 			// 过期删除entry
-			c.removeElement(ele)
+			c.removeElement(ele, EvictExpired)
 			log.Printf("The key - %s has expired ",key)
 			return nil,false
 		}
@@ -90,13 +124,45 @@ func (c *LFUCache)Get(key string)(value Value,ok bool){
 	return
 }
 
+// 查找但不增加访问频率 已经过期时返回false 但不会删除
+func (c *LFUCache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok && !ele.expire.Before(time.Now()) {
+		return ele.value, true
+	}
+	return
+}
+// 判断key是否存在并且没有过期 不增加访问频率
+func (c *LFUCache) Contains(key string) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
 // 删除频率最低的缓存 
 func (c *LFUCache)RemoveOldest(){
-	entry := heap.Pop(c.heap).(*entry)
-	delete(c.cache,entry.key)
-	c.nBytes -= int64(len(entry.key)) + int64(entry.value.Len())
-	if c.OnEvicted != nil {
-		c.OnEvicted(entry.key, entry.value)
+	if c.heap.Len() == 0 {
+		return
+	}
+	c.removeElement((*c.heap)[0], EvictCapacity)
+}
+// 删除指定的key 返回key是否存在
+func (c *LFUCache) Remove(key string) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.removeElement(ele, EvictExplicit)
+	return true
+}
+// 删除所有缓存 每个缓存都会调用回调函数
+func (c *LFUCache) Clear() {
+	for c.heap.Len() > 0 {
+		c.removeElement((*c.heap)[0], EvictExplicit)
+	}
+}
+// 修改最大容量 超过新的容量时淘汰频率最低的缓存 为0表示不做限制
+func (c *LFUCache) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
+		c.RemoveOldest()
 	}
 }
 // 实现add函数 插入一个缓存 
@@ -104,9 +170,12 @@ func (c *LFUCache)Add(key string,value Value,ttl time.Duration){
 	// 如果当前缓存中已经有 
 	if ele,ok := c.cache[key];ok{
 		ele.number++
+		c.nBytes += int64(value.Len()) - int64(ele.value.Len())
+		old := ele.value
 		ele.value = value
 		ele.expire = time.Now().Add(ttl)
 		heap.Fix(c.heap,ele.index)
+		c.evicted(key, old, EvictReplaced)
 	}else{
 		// 不存在缓存 
 		// 1 先初始化一个entry 
@@ -119,23 +188,72 @@ func (c *LFUCache)Add(key string,value Value,ttl time.Duration){
 		// 然后插入到堆中 
 		heap.Push(c.heap,entry)
 		c.cache[key] = entry
-		c.nBytes += int64(len(key)) + int64(value.Len())
+		c.nBytes += int64(len(key)) + int64(value.Len()) + c.overhead
 	}
 	// 如果超过了最大容量就删除最少使用次数的 
 	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
 		c.RemoveOldest()
 	}
 }
+// 遍历没有过期的缓存 不保证顺序 不会改变访问频率 fn返回false时停止
+func (c *LFUCache) Range(fn func(key string, value Value) bool) {
+	now := time.Now()
+	for key, e := range c.cache {
+		if e.expire.Before(now) {
+			continue
+		}
+		if !fn(key, e.value) {
+			return
+		}
+	}
+}
+// 按字典序分页返回以prefix开头并且大于cursor的key 最多返回limit个 limit<=0表示不限制
+// 还有更多的key时next为本页最后一个key 作为下一次的cursor 否则为空字符串
+// 需要遍历并排序所有key 时间复杂度为O(n log n)
+func (c *LFUCache) Keys(prefix, cursor string, limit int) (keys []string, next string) {
+	c.Range(func(key string, value Value) bool {
+		if strings.HasPrefix(key, prefix) && key > cursor {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	return
+}
 // Len 方法返回当前缓存中的记录数量。
 func (c *LFUCache) Len() int {
 	return len(c.cache)
 }
+// 设置每个条目除了key和value之外额外计算的字节数 例如entry、堆和map槽位占用的内存
+// 默认为0 只计算key和value 已有的条目按新的值重新计算 超过容量时淘汰
+func (c *LFUCache) SetEntryOverhead(overhead int64) {
+	c.nBytes += (overhead - c.overhead) * int64(len(c.cache))
+	c.overhead = overhead
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
+		c.RemoveOldest()
+	}
+}
+// 返回按key、value和额外开销计算的内存占用
+func (c *LFUCache) MemoryUsage() int64 {
+	return c.nBytes
+}
 // removeElement 函数删除传入的缓存项。
-func (c *LFUCache) removeElement(e *entry) {
+func (c *LFUCache) removeElement(e *entry, reason EvictReason) {
 	heap.Remove(c.heap, e.index)
 	delete(c.cache, e.key)
-	c.nBytes -= int64(len(e.key)) + int64(e.value.Len())
-	if c.OnEvicted != nil {
-		c.OnEvicted(e.key, e.value)
+	c.nBytes -= int64(len(e.key)) + int64(e.value.Len()) + c.overhead
+	c.evicted(e.key, e.value, reason)
+}
+// 调用删除的回调函数
+func (c *LFUCache) evicted(key string, value Value, reason EvictReason) {
+	if c.OnEvicted != nil && reason != EvictReplaced {
+		c.OnEvicted(key, value)
+	}
+	if c.OnEvictedReason != nil {
+		c.OnEvictedReason(key, value, reason)
 	}
 }
\ No newline at end of file
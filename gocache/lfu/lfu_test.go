@@ -1,6 +1,10 @@
 package lfu
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 type String string
 
@@ -20,3 +24,75 @@ func TestGet(t *testing.T) {
 		t.Fatalf("cache miss key2 failed")
 	}
 }
+
+func TestKeys(t *testing.T) {
+	lfu := New(int64(0), nil, time.Hour)
+	for _, k := range []string{"user:3", "user:1", "order:1", "user:2"} {
+		lfu.Add(k, String("v"), time.Hour)
+	}
+	lfu.Add("user:0", String("v"), -time.Second)
+	keys, next := lfu.Keys("user:", "", 2)
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:2"}) || next != "user:2" {
+		t.Fatalf("first page = %v next %q", keys, next)
+	}
+	keys, next = lfu.Keys("user:", next, 2)
+	if !reflect.DeepEqual(keys, []string{"user:3"}) || next != "" {
+		t.Fatalf("second page = %v next %q", keys, next)
+	}
+	n := 0
+	lfu.Range(func(key string, value Value) bool {
+		n++
+		return true
+	})
+	if n != 4 {
+		t.Fatalf("Range should skip expired entries, got %d", n)
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	lfu := New(int64(10), nil, time.Hour)
+	lfu.OnEvictedReason = func(key string, value Value, reason EvictReason) {
+		reasons[key+"="+string(value.(String))] = reason
+	}
+	lfu.Add("k1", String("v1"), time.Hour)
+	lfu.Add("k1", String("v9"), time.Hour)
+	lfu.Add("k2", String("v2"), time.Hour)
+	lfu.Get("k2")
+	// k3的访问频率最低 加入后立即被淘汰
+	lfu.Add("k3", String("v3"), time.Hour)
+	lfu.Remove("k2")
+	lfu.Add("k4", String("v4"), -time.Second)
+	if _, ok := lfu.Peek("k4"); ok || !lfu.Contains("k1") {
+		t.Fatalf("Peek should skip expired entries")
+	}
+	lfu.Get("k4")
+	expect := map[string]EvictReason{"k1=v1": EvictReplaced, "k3=v3": EvictCapacity, "k2=v2": EvictExplicit, "k4=v4": EvictExpired}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("expect reasons %v, got %v", expect, reasons)
+	}
+	lfu.Add("k5", String("v5"), time.Hour)
+	lfu.Resize(4)
+	if lfu.Len() != 1 || lfu.nBytes != 4 {
+		t.Fatalf("Resize should evict to 4 bytes, got %d entries", lfu.Len())
+	}
+	lfu.Clear()
+	if lfu.Len() != 0 || lfu.nBytes != 0 {
+		t.Fatalf("Clear failed")
+	}
+}
+
+func TestEntryOverhead(t *testing.T) {
+	lfu := New(int64(30), nil, time.Hour)
+	lfu.Add("k1", String("v1"), time.Hour)
+	lfu.SetEntryOverhead(10)
+	lfu.Add("k2", String("v2"), time.Hour)
+	lfu.Add("k2", String("v22"), time.Hour)
+	if lfu.MemoryUsage() != 29 {
+		t.Fatalf("MemoryUsage = %d, want 29", lfu.MemoryUsage())
+	}
+	lfu.Add("k3", String("v3"), time.Hour)
+	if lfu.Len() != 2 || lfu.Contains("k1") {
+		t.Fatalf("overhead should count towards maxBytes")
+	}
+}
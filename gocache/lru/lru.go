@@ -6,7 +6,11 @@
  */
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"sort"
+	"strings"
+)
 
 // 使用lru淘汰策略
 type Cache struct{
@@ -14,12 +18,44 @@ type Cache struct{
 	maxBytes int64
 	// 当前已经使用的内存 
 	nbytes int64
+	// 每个条目除了key和value之外额外计算的字节数 
+	overhead int64
 	// 双向链表 lru
 	ll *list.List
 	// cache键值对
 	cache map[string]*list.Element
-	// 记录移除时的回调函数 
+	// 记录移除时的回调函数 替换旧值时不调用
 	OnEvicted func(key string,value Value)
+	// 带有移除原因的回调函数 替换旧值时也会调用 参数为旧值
+	OnEvictedReason func(key string, value Value, reason EvictReason)
+}
+
+// 缓存被移除的原因
+type EvictReason int
+
+const (
+	// 已经过期 lru没有过期时间 不会使用
+	EvictExpired EvictReason = iota
+	// 超过容量被淘汰
+	EvictCapacity
+	// 调用Remove或者Clear删除
+	EvictExplicit
+	// 被新的值替换
+	EvictReplaced
+)
+
+func (r EvictReason) String() string{
+	switch r{
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictExplicit:
+		return "explicit"
+	case EvictReplaced:
+		return "replaced"
+	}
+	return "unknown"
 }
 // 这是双向链表中的节点数量类型，在链表中也保存了对应的key，
 // 为了方便在淘汰队首节点时，需要通过key删除对应的映射 
@@ -53,22 +89,78 @@ func (c *Cache) Get(key string)(value Value,ok bool){
 	}
 	return 
 }
+// 查找但不改变访问顺序 
+func (c *Cache) Peek(key string)(value Value,ok bool){
+	if ele,ok := c.cache[key];ok{
+		return ele.Value.(*entry).value,true
+	}
+	return
+}
+// 判断key是否存在 不改变访问顺序
+func (c *Cache) Contains(key string) bool{
+	_, ok := c.cache[key]
+	return ok
+}
 // 缓存淘汰 即淘汰最近最少访问的节点 
 func(c *Cache)RemoveOldest(){
 	// 先回去到最后一个元素
 	ele := c.ll.Back()
 	if ele != nil{
-		// 删除 
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		// 删除map中key对应的键值对
-		delete(c.cache,kv.key)
-		// 然后改变当前所拥有的字节数 删除key和value对应的字节数 
-		c.nbytes = c.nbytes - int64(len(kv.key)) - int64(kv.value.Len())
-		// 如果删除缓存的回调函数存在就要执行对应的回调函数 
-		if c.OnEvicted!=nil{
-			c.OnEvicted(kv.key,kv.value)
-		}
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+// 删除指定的key 返回key是否存在
+func (c *Cache) Remove(key string) bool{
+	ele, ok := c.cache[key]
+	if !ok{
+		return false
+	}
+	c.removeElement(ele, EvictExplicit)
+	return true
+}
+// 删除所有缓存 每个缓存都会调用回调函数
+func (c *Cache) Clear(){
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back(){
+		c.removeElement(ele, EvictExplicit)
+	}
+}
+// 修改最大内存 超过新的容量时淘汰最久未访问的缓存 为0表示不做限制
+func (c *Cache) Resize(maxBytes int64){
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes{
+		c.RemoveOldest()
+	}
+}
+// 设置每个条目除了key和value之外额外计算的字节数 例如链表节点、entry和map槽位占用的内存
+// 默认为0 只计算key和value 已有的条目按新的值重新计算 超过容量时淘汰
+func (c *Cache) SetEntryOverhead(overhead int64){
+	c.nbytes += (overhead - c.overhead) * int64(c.ll.Len())
+	c.overhead = overhead
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes{
+		c.RemoveOldest()
+	}
+}
+// 返回按key、value和额外开销计算的内存占用 
+func (c *Cache) MemoryUsage() int64{
+	return c.nbytes
+}
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason){
+	// 删除 
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	// 删除map中key对应的键值对
+	delete(c.cache,kv.key)
+	// 然后改变当前所拥有的字节数 删除key和value对应的字节数 
+	c.nbytes = c.nbytes - int64(len(kv.key)) - int64(kv.value.Len()) - c.overhead
+	c.evicted(kv.key, kv.value, reason)
+}
+// 如果删除缓存的回调函数存在就要执行对应的回调函数 
+func (c *Cache) evicted(key string, value Value, reason EvictReason){
+	if c.OnEvicted != nil && reason != EvictReplaced{
+		c.OnEvicted(key, value)
+	}
+	if c.OnEvictedReason != nil{
+		c.OnEvictedReason(key, value, reason)
 	}
 }
 // 修改或新增缓存 
@@ -80,7 +172,9 @@ func(c *Cache) Add(key string,value Value){
 		kv := ele.Value.(*entry)
 		// 改变当前字节
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		old := kv.value
 		kv.value = value
+		c.evicted(key, old, EvictReplaced)
 	}else{
 		// 新增 
 		ele := c.ll.PushFront(&entry{
@@ -88,13 +182,39 @@ func(c *Cache) Add(key string,value Value){
 			value: value,
 		})
 		c.cache[key] = ele
-		c.nbytes += int64(value.Len()) + int64(len(key))
+		c.nbytes += int64(value.Len()) + int64(len(key)) + c.overhead
 	}
 	// 如果当前的最大字节容量已经小于当前容量那么就要淘汰 为0表示不做限制
 	for c.maxBytes!=0 && c.maxBytes < c.nbytes{
 		c.RemoveOldest()
 	}
 }
+// 按从最近访问到最久未访问的顺序遍历缓存 不会改变访问顺序 fn返回false时停止
+func (c *Cache) Range(fn func(key string, value Value) bool){
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next(){
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value){
+			return
+		}
+	}
+}
+// 按字典序分页返回以prefix开头并且大于cursor的key 最多返回limit个 limit<=0表示不限制
+// 还有更多的key时next为本页最后一个key 作为下一次的cursor 否则为空字符串
+// 需要遍历并排序所有key 时间复杂度为O(n log n)
+func (c *Cache) Keys(prefix, cursor string, limit int) (keys []string, next string){
+	c.Range(func(key string, value Value) bool{
+		if strings.HasPrefix(key, prefix) && key > cursor{
+			keys = append(keys, key)
+		}
+		return true
+	})
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit{
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	return
+}
 //测试 
 func(c *Cache)Len() int{
 	return c.ll.Len()
@@ -43,6 +43,115 @@ func TestRemoveoldest(t *testing.T){
 	}
 }
 
+// 测试删除
+func TestRemove(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	if !lru.Remove("k1") || lru.Remove("k1") || lru.Len() != 1 || lru.nbytes != int64(len("k2v2")) {
+		t.Fatalf("Remove k1 failed")
+	}
+	if _, ok := lru.Get("k1"); ok || !reflect.DeepEqual(keys, []string{"k1"}) {
+		t.Fatalf("removed key should not be found")
+	}
+}
+
+// 测试遍历顺序
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	lru.Get("k1")
+	keys := make([]string, 0)
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return len(keys) < 2
+	})
+	if expect := []string{"k1", "k3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Range failed, expect keys equals to %s, got %s", expect, keys)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lru := New(int64(0), nil)
+	for _, k := range []string{"user:3", "user:1", "order:1", "user:2"} {
+		lru.Add(k, String("v"))
+	}
+	keys, next := lru.Keys("user:", "", 2)
+	if expect := []string{"user:1", "user:2"}; !reflect.DeepEqual(expect, keys) || next != "user:2" {
+		t.Fatalf("Keys failed, expect keys equals to %s, got %s next %q", expect, keys, next)
+	}
+	keys, next = lru.Keys("user:", next, 2)
+	if expect := []string{"user:3"}; !reflect.DeepEqual(expect, keys) || next != "" {
+		t.Fatalf("Keys failed, expect keys equals to %s, got %s next %q", expect, keys, next)
+	}
+	// Peek不改变访问顺序
+	lru.Peek("user:3")
+	lru.Range(func(key string, value Value) bool {
+		keys = []string{key}
+		return true
+	})
+	if keys[0] != "user:3" {
+		t.Fatalf("Peek should not change the access order")
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	evicted := 0
+	lru := New(int64(10), func(key string, value Value) { evicted++ })
+	lru.OnEvictedReason = func(key string, value Value, reason EvictReason) {
+		reasons[key+"="+string(value.(String))] = reason
+	}
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k1", String("v9"))
+	lru.Add("k3", String("v3"))
+	lru.Remove("k1")
+	expect := map[string]EvictReason{"k1=v1": EvictReplaced, "k2=v2": EvictCapacity, "k1=v9": EvictExplicit}
+	if !reflect.DeepEqual(expect, reasons) || evicted != 2 {
+		t.Fatalf("expect reasons %v, got %v, OnEvicted called %d times", expect, reasons, evicted)
+	}
+	if !lru.Contains("k3") || lru.Contains("k1") {
+		t.Fatalf("Contains failed")
+	}
+	lru.Add("k4", String("v4"))
+	lru.Resize(4)
+	if lru.Len() != 1 || !lru.Contains("k4") || reasons["k3=v3"] != EvictCapacity {
+		t.Fatalf("Resize should evict the oldest entries, got %v", reasons)
+	}
+	lru.Clear()
+	if lru.Len() != 0 || lru.nbytes != 0 || reasons["k4=v4"] != EvictExplicit {
+		t.Fatalf("Clear failed")
+	}
+}
+
+func TestEntryOverhead(t *testing.T) {
+	lru := New(int64(30), nil)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	if lru.MemoryUsage() != 8 {
+		t.Fatalf("MemoryUsage = %d, want 8", lru.MemoryUsage())
+	}
+	// 每个条目额外计算10字节 已有的条目重新计算
+	lru.SetEntryOverhead(10)
+	if lru.MemoryUsage() != 28 {
+		t.Fatalf("MemoryUsage = %d, want 28", lru.MemoryUsage())
+	}
+	lru.Add("k3", String("v3"))
+	if lru.Len() != 2 || lru.Contains("k1") || lru.MemoryUsage() != 28 {
+		t.Fatalf("overhead should count towards maxBytes")
+	}
+	lru.Remove("k2")
+	if lru.MemoryUsage() != 14 {
+		t.Fatalf("MemoryUsage = %d, want 14", lru.MemoryUsage())
+	}
+}
+
 // 测试回调函数 
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
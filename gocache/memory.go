@@ -0,0 +1,67 @@
+package gocache
+
+import (
+	"runtime"
+	"strconv"
+)
+
+/*
+	内存统计
+	lru和lfu默认只按len(key)+value.Len()计算内存 对于小值 链表节点、entry、map槽位、
+	装箱后的ByteView和key索引节点占用的内存远大于数据本身 实际内存会远超cacheBytes。
+	默认保持这种计算方式 可以通过WithEntryOverhead(DefaultEntryOverhead)为每个条目额外计算开销
+	或者传入MeasureEntryOverhead在当前平台上测量的结果。标签索引和墓碑占用的内存不计算在内。
+*/
+
+// 每个条目除了key和value之外占用的字节数 可以传给WithEntryOverhead 按amd64上分配的大小估算:
+// 链表节点48 entry 32 装箱的ByteView 112 key索引节点约56 map槽位约40
+var DefaultEntryOverhead int64 = 288
+
+// 设置每个条目除了key和value之外额外计算的字节数 默认为0 只计算key和value
+func WithEntryOverhead(n int64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.entryOverhead = n
+		g.hotCache.entryOverhead = n
+	}
+}
+
+// 返回mainCache和hotCache的内存占用 包括每个条目的额外开销
+// 通过TypedGroup创建时 还包括解码后对象缓存按编码后的字节数统计的占用
+func (g *Group) MemoryUsage() int64 {
+	usage := g.mainCache.memoryUsage() + g.hotCache.memoryUsage()
+	if g.derived != nil {
+		usage += g.derived.memoryUsage()
+	}
+	return usage
+}
+
+// 实际写入n个条目 测量每个条目除了key和value之外占用的内存 结果可以传给WithEntryOverhead
+// 会触发两次GC 适合在启动时调用一次
+func MeasureEntryOverhead(n int) int64 {
+	if n <= 0 {
+		return 0
+	}
+	// key和value提前分配 测量的只有缓存自身的开销
+	keys := make([]string, n)
+	values := make([]ByteView, n)
+	for i := range keys {
+		keys[i] = "k" + strconv.Itoa(i)
+		values[i] = ByteView{b: []byte(keys[i])}
+	}
+	c := &cache{}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i, key := range keys {
+		c.add(key, values[i])
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(c)
+	runtime.KeepAlive(keys)
+	runtime.KeepAlive(values)
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return int64(after.HeapAlloc-before.HeapAlloc) / int64(n)
+}
@@ -0,0 +1,76 @@
+package gocache
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// 写入n个小值 返回堆内存的增长
+func fillCache(c *cache, n int) int64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for i := 0; i < n; i++ {
+		key := "key:" + strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte("v" + strconv.Itoa(i))})
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(c)
+	return int64(after.HeapAlloc) - int64(before.HeapAlloc)
+}
+
+func TestMemoryUsage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates a large cache")
+	}
+	const n = 200000
+	overhead := MeasureEntryOverhead(n)
+	if overhead <= 0 {
+		t.Fatalf("measured overhead %d", overhead)
+	}
+	t.Logf("measured overhead %d bytes per entry, default %d", overhead, DefaultEntryOverhead)
+	if DefaultEntryOverhead < overhead/2 || DefaultEntryOverhead > overhead*2 {
+		t.Errorf("default overhead %d is far from measured %d", DefaultEntryOverhead, overhead)
+	}
+
+	// 只计算key和value时 报告的内存远小于实际占用
+	naive := &cache{}
+	heap := fillCache(naive, n)
+	if reported := naive.memoryUsage(); reported*3 > heap {
+		t.Errorf("expected naive accounting to underestimate: reported %d, heap %d", reported, heap)
+	}
+
+	// 加上测量的开销后 误差在20%以内
+	c := &cache{entryOverhead: overhead}
+	heap = fillCache(c, n)
+	reported := c.memoryUsage()
+	if diff := float64(reported-heap) / float64(heap); diff > 0.2 || diff < -0.2 {
+		t.Errorf("reported %d bytes, heap grew %d bytes (%.1f%%)", reported, heap, diff*100)
+	}
+}
+
+// cacheBytes限制包括额外开销 默认不计算
+func TestEntryOverhead(t *testing.T) {
+	if g := NewGroup("no-overhead", 0, GetterFunc(nil)); g.mainCache.entryOverhead != 0 || g.hotCache.entryOverhead != 0 {
+		t.Fatalf("entry overhead should be opt-in")
+	}
+	g := NewGroup("overhead", 10*(9+100), GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v" + key), nil
+	}), WithEntryOverhead(100))
+	for i := 0; i < 20; i++ {
+		g.Get("k" + strconv.Itoa(100+i))
+	}
+	if n := g.mainCache.lru.Len(); n != 10 {
+		t.Fatalf("cache should hold 10 entries, got %d", n)
+	}
+	if usage := g.MemoryUsage(); usage != 10*(9+100) {
+		t.Fatalf("MemoryUsage = %d", usage)
+	}
+	g.mainCache.resize(0)
+	g.mainCache.clear()
+	if usage := g.MemoryUsage(); usage != 0 {
+		t.Fatalf("MemoryUsage after clear = %d", usage)
+	}
+}
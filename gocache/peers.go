@@ -6,7 +6,10 @@
  */
 package gocache
 // import pb "goCache/gocache/gocachepb/gocachepb"
-import pb "goCache/gocache/gocachepb"
+import (
+	"context"
+	pb "goCache/gocache/gocachepb"
+)
 
 type PeerPicker interface {
 	// 根据传入的key选择响应的节点 getter
@@ -14,7 +17,25 @@ type PeerPicker interface {
 }
 
 type PeerGetter interface {
-	// 通过get来从对应group中查找缓存值
+	// 通过get来从对应group中查找缓存值 ctx用于控制超时和取消
 	// Get(group string,key string)([]byte,error)
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// 支持故障转移的PeerPicker owner不可用时按哈希环的顺序选择后继节点
+type FailoverPicker interface {
+	// 返回key的owner在哈希环上之后的最多n个不同节点
+	// 遇到自身时停止 此时local为true 表示自身是下一个应该负责该key的节点
+	PickFailover(key string, n int) (peers []PeerGetter, local bool)
+}
+
+// 可以接收交接数据的PeerGetter
+type PeerTransferer interface {
+	// 打开一个到该节点的交接流 发送完成后调用CloseAndRecv
+	OpenTransfer(ctx context.Context) (pb.GroupCache_TransferClient, error)
+}
+
+// 可以判断key是否由自身负责的PeerPicker 不考虑节点是否可用
+type OwnerPicker interface {
+	Owns(key string) bool
 }
@@ -0,0 +1,155 @@
+package gocache
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	提前刷新
+	记录mainCache中每个key最近一次被访问的时间，后台定期扫描:
+	最近仍然被访问、并且距离过期时间小于Window的key，通过singleflight在本地重新加载，
+	这样热门key在过期之前就已经更新，读取时不会出现未命中。
+	只刷新mainCache中的key，从其他节点获取的值由owner负责刷新。
+*/
+
+// 提前刷新配置
+type RefreshAheadConfig struct {
+	// 距离过期时间小于该值时提前刷新
+	Window time.Duration
+	// 最近多久之内被访问过的key才会刷新
+	AccessedWithin time.Duration
+	// 扫描间隔
+	Interval time.Duration
+	// 同时进行的刷新数量
+	Concurrency int
+	// 最多记录多少个key的访问时间 0表示不限制
+	MaxKeys int
+}
+
+// 开启提前刷新 需要配合WithTTL 后台任务在NewGroup应用完所有配置后启动
+// 通过Close或者StopRefreshAhead停止 同名的group被替换时自动停止
+func WithRefreshAhead(cfg RefreshAheadConfig) GroupOption {
+	return func(g *Group) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Second
+		}
+		if cfg.Concurrency <= 0 {
+			cfg.Concurrency = 1
+		}
+		g.refresher = &refresher{
+			cfg:      cfg,
+			g:        g,
+			accessed: map[string]time.Time{},
+			sem:      make(chan struct{}, cfg.Concurrency),
+			stop:     make(chan struct{}),
+		}
+	}
+}
+
+// 停止提前刷新
+func (g *Group) StopRefreshAhead() {
+	if g.refresher != nil {
+		g.refresher.stopOnce.Do(func() { close(g.refresher.stop) })
+	}
+}
+
+// 停止group的后台任务 之后仍然可以读取 但不再提前刷新
+func (g *Group) Close() {
+	g.StopRefreshAhead()
+}
+
+type refresher struct {
+	cfg RefreshAheadConfig
+	g   *Group
+	mu  sync.Mutex
+	// key最近一次被访问的时间
+	accessed map[string]time.Time
+	// 限制同时进行的刷新数量
+	sem      chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	// 正在刷新的key
+	inflight sync.Map
+}
+
+// 记录key被访问
+func (r *refresher) touch(key string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.accessed[key]; !ok && r.cfg.MaxKeys > 0 && len(r.accessed) >= r.cfg.MaxKeys {
+		return
+	}
+	r.accessed[key] = now
+}
+
+func (r *refresher) run() {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.scan(now)
+		}
+	}
+}
+
+// 找出需要刷新的key并开始刷新
+func (r *refresher) scan(now time.Time) {
+	var keys []string
+	r.mu.Lock()
+	for key, at := range r.accessed {
+		if now.Sub(at) > r.cfg.AccessedWithin {
+			// 最近没有被访问 不再跟踪
+			delete(r.accessed, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	r.mu.Unlock()
+
+	for _, key := range keys {
+		v, ok := r.g.mainCache.peek(key)
+		if !ok {
+			// 已经被淘汰
+			r.mu.Lock()
+			delete(r.accessed, key)
+			r.mu.Unlock()
+			continue
+		}
+		if v.e.IsZero() || v.e.Sub(now) > r.cfg.Window {
+			continue
+		}
+		if _, loaded := r.inflight.LoadOrStore(key, struct{}{}); loaded {
+			continue
+		}
+		select {
+		case r.sem <- struct{}{}:
+		default:
+			// 达到并发上限 下次扫描再刷新
+			r.inflight.Delete(key)
+			r.g.Stats.RefreshSkipped.Add(1)
+			continue
+		}
+		go r.refresh(key)
+	}
+}
+
+func (r *refresher) refresh(key string) {
+	defer func() {
+		<-r.sem
+		r.inflight.Delete(key)
+	}()
+	_, err := r.g.loader.Do(key, func() (interface{}, error) {
+		return r.g.getLocally(key)
+	})
+	if err != nil {
+		r.g.Stats.RefreshErrs.Add(1)
+		log.Printf("[gocache] refresh ahead %s/%s failed: %v", r.g.name, key, err)
+		return
+	}
+	r.g.Stats.Refreshes.Add(1)
+}
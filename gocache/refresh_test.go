@@ -0,0 +1,85 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("refresh", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				<-release
+			}
+			return []byte(key), nil
+		}), WithTTL(time.Minute), WithRefreshAhead(RefreshAheadConfig{
+		Window:         10 * time.Second,
+		AccessedWithin: time.Minute,
+		Interval:       time.Hour,
+		Concurrency:    1,
+	}))
+	defer g.StopRefreshAhead()
+	now := time.Now()
+	g.mainCache.add("hot", ByteView{s: "old", e: now.Add(5 * time.Second)})
+	g.mainCache.add("later", ByteView{s: "old", e: now.Add(time.Minute)})
+	g.mainCache.add("cold", ByteView{s: "old", e: now.Add(5 * time.Second)})
+	for _, key := range []string{"hot", "later"} {
+		g.Get(key)
+	}
+	g.refresher.touch("cold", now.Add(-2*time.Minute))
+
+	// 只刷新最近被访问并且快要过期的key
+	g.refresher.scan(now)
+	for g.Stats.Refreshes.Get() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := g.mainCache.get("hot"); v.String() != "hot" {
+		t.Fatalf("hot key should be refreshed, got %q", v.String())
+	}
+	for _, key := range []string{"later", "cold"} {
+		if v, _ := g.mainCache.get(key); v.String() != "old" {
+			t.Fatalf("%s should not be refreshed", key)
+		}
+	}
+	if _, ok := g.refresher.accessed["cold"]; ok {
+		t.Fatalf("cold key should no longer be tracked")
+	}
+
+	// 达到并发上限时跳过
+	g.mainCache.add("slow", ByteView{s: "old", e: now.Add(time.Second)})
+	g.refresher.touch("slow", now)
+	g.refresher.scan(now)
+	for len(g.refresher.sem) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	g.mainCache.add("hot", ByteView{s: "old", e: now.Add(time.Second)})
+	g.refresher.scan(now)
+	if g.Stats.RefreshSkipped.Get() == 0 {
+		t.Fatalf("refresh should be skipped at concurrency limit")
+	}
+	close(release)
+}
+
+// 同名的group被替换时 旧group的后台刷新停止
+func TestRefreshAheadReplaced(t *testing.T) {
+	newGroup := func() *Group {
+		return NewGroup("refresh-replaced", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithTTL(time.Minute), WithRefreshAhead(RefreshAheadConfig{Interval: time.Hour}))
+	}
+	old := newGroup()
+	g := newGroup()
+	defer g.Close()
+	select {
+	case <-old.refresher.stop:
+	default:
+		t.Fatalf("replaced group should stop refreshing")
+	}
+	select {
+	case <-g.refresher.stop:
+		t.Fatalf("new group should keep refreshing")
+	default:
+	}
+}
@@ -0,0 +1,172 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gpb "goCache/gocache/gocachepb"
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	副本
+	owner从数据源加载到新的值后，异步推送给哈希环上之后的Factor-1个节点，
+	副本节点把值写入自己的mainCache。owner不可用时，读取方通过故障转移
+	请求后继节点，后继节点直接返回缓存中的副本，不会集中回源。
+
+	一致性上的取舍:
+	  - 推送是异步、尽力而为的 推送失败不会重试 owner返回时副本可能还没有写入
+	  - 副本只在owner重新加载时更新 owner上的值被淘汰或者过期后 副本上可能仍是旧值
+	  - 多次推送到达的顺序不确定 带有过期时间时 副本只接受过期时间更晚的值
+	    没有过期时间时后到达的值覆盖先到达的值
+	  - 副本同样受TTL约束 过期后不会再返回
+	因此副本适合可以接受短时间旧值的场景 需要强一致时不要开启。
+*/
+
+// 副本配置
+type ReplicationConfig struct {
+	// 每个key保存的份数 包括owner 小于等于1表示不复制
+	Factor int
+	// 每次推送的超时时间 0表示使用Client的默认超时时间
+	Timeout time.Duration
+}
+
+// 开启副本 需要注册的PeerPicker实现Replicator
+// 没有设置故障转移时 自动开启故障转移 最多尝试Factor-1个后继节点
+func WithReplication(cfg ReplicationConfig) GroupOption {
+	return func(g *Group) {
+		g.replication = &cfg
+	}
+}
+
+// 副本节点已经有更新的值或者值已经失效时会拒绝写入 不是推送失败
+var ErrReplicaRejected = errors.New("gocache: replica rejected")
+
+// 没有可用的副本节点 例如都被熔断器剔除 没有推送任何值
+var ErrNoReplicas = errors.New("gocache: no replica available")
+
+// 可以把值推送给副本节点的PeerPicker
+type Replicator interface {
+	// 把key的值推送给哈希环上owner之后的n个节点 返回第一个错误
+	// 只有副本节点拒绝写入时返回包装了ErrReplicaRejected的错误 没有可用的副本节点时返回ErrNoReplicas
+	Replicate(ctx context.Context, group, key string, value ByteView, n int) error
+}
+
+// owner加载到新值后异步推送给副本节点
+func (g *Group) replicate(key string, value ByteView) {
+	r, ok := g.peers.(Replicator)
+	if !ok || g.replication.Factor <= 1 || !g.owns(key) {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		if g.replication.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.replication.Timeout)
+			defer cancel()
+		}
+		err := r.Replicate(ctx, g.name, key, value, g.replication.Factor-1)
+		if errors.Is(err, ErrReplicaRejected) {
+			g.Stats.ReplicaRejected.Add(1)
+			return
+		}
+		if errors.Is(err, ErrNoReplicas) {
+			return
+		}
+		if err != nil {
+			g.Stats.ReplicaErrs.Add(1)
+			log.Printf("[gocache] replicate %s/%s failed: %v", g.name, key, err)
+			return
+		}
+		g.Stats.ReplicaPushes.Add(1)
+	}()
+}
+
+// 实现Replicator 同时推送给所有副本节点
+func (p *Server) Replicate(ctx context.Context, group, key string, value ByteView, n int) error {
+	p.mu.Lock()
+	var targets []PeerTransferer
+	for _, peer := range p.peers.GetN(key, n+1) {
+		if peer == p.self {
+			continue
+		}
+		if c, ok := p.clients[peer]; ok && !c.breaker.ejected() {
+			if t, ok := c.getter.(PeerTransferer); ok {
+				targets = append(targets, t)
+			}
+		}
+	}
+	p.mu.Unlock()
+	if len(targets) == 0 {
+		return ErrNoReplicas
+	}
+
+	entry := &gpb.Entry{Key: key, Value: value.bytes(), Compression: value.c, Version: value.ver, Tags: value.tags}
+	if !value.e.IsZero() {
+		entry.Expire = value.e.UnixNano()
+	}
+	req := &gpb.TransferRequest{Group: group, Entries: []*gpb.Entry{entry}, Replica: true}
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t PeerTransferer) {
+			defer wg.Done()
+			errs[i] = pushReplica(ctx, t, req)
+		}(i, t)
+	}
+	wg.Wait()
+	// 优先返回传输错误
+	var rejected error
+	for _, err := range errs {
+		if errors.Is(err, ErrReplicaRejected) {
+			if rejected == nil {
+				rejected = err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return rejected
+}
+
+func pushReplica(ctx context.Context, t PeerTransferer, req *gpb.TransferRequest) error {
+	stream, err := t.OpenTransfer(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(req); err != nil {
+		stream.CloseAndRecv()
+		return err
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if resp.Accepted != int64(len(req.Entries)) {
+		return fmt.Errorf("%w: accepted %d of %d entries", ErrReplicaRejected, resp.Accepted, len(req.Entries))
+	}
+	return nil
+}
+
+// 写入推送过来的副本 只接受版本号更新的值 旧版本节点推送的值没有版本号 按过期时间比较
+// 版本号早于最近一次失效的值不接受 推送可能是失效之前发出的
+func (g *Group) acceptReplica(e *gpb.Entry, now time.Time) bool {
+	v := ByteView{b: e.Value, c: e.Compression, ver: e.Version, tags: e.Tags}
+	if e.Expire != 0 {
+		v.e = time.Unix(0, e.Expire)
+	}
+	if !v.fresh(now) {
+		return false
+	}
+	if old, ok := g.mainCache.peek(e.Key); ok && e.Version == 0 && !old.e.IsZero() && !v.e.IsZero() && old.e.After(v.e) {
+		return false
+	}
+	v, err := g.storageView(v)
+	if err != nil {
+		return false
+	}
+	return g.populateCache(e.Key, v)
+}
@@ -0,0 +1,119 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	gpb "goCache/gocache/gocachepb"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplication(t *testing.T) {
+	addrs := []string{"a:3", "b:3", "c:3"}
+	servers, groups, loads := startCluster(t, addrs, []GroupOption{WithReplication(ReplicationConfig{Factor: 2, Timeout: time.Second})})
+	for _, svr := range servers {
+		svr.Set(addrs...)
+	}
+	var key string
+	for i := 0; ; i++ {
+		key = strconv.Itoa(i)
+		if nodes := servers["c:3"].peers.GetN(key, 2); nodes[0] == "a:3" && nodes[1] == "b:3" {
+			break
+		}
+	}
+
+	// owner加载后推送给下一个节点
+	if v, err := groups["c:3"].Get(key); err != nil || v.String() != "v"+key {
+		t.Fatalf("get %s: %q %v", key, v.String(), err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for groups["a:3"].Stats.ReplicaPushes.Get() == 0 {
+		if time.Now().After(deadline) || groups["a:3"].Stats.ReplicaErrs.Get() > 0 {
+			t.Fatalf("value should be pushed to replica")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, ok := groups["b:3"].mainCache.get(key); !ok || v.String() != "v"+key {
+		t.Fatalf("replica should be cached on b")
+	}
+	if loads["a:3"].Get() != 1 || loads["b:3"].Get() != 0 {
+		t.Fatalf("only owner should load, got a=%d b=%d", loads["a:3"].Get(), loads["b:3"].Get())
+	}
+
+	// owner不可用时从副本读取 不会回源
+	servers["c:3"].clients["a:3"].getter = &fakePeer{err: errors.New("unavailable")}
+	if v, err := groups["c:3"].Get(key); err != nil || v.String() != "v"+key {
+		t.Fatalf("should read from replica, got %q %v", v.String(), err)
+	}
+	if loads["b:3"].Get() != 0 || groups["c:3"].Stats.FailoverLoads.Get() != 1 {
+		t.Fatalf("replica should serve the read, b loads %d", loads["b:3"].Get())
+	}
+
+	// 副本节点不会继续推送
+	if groups["b:3"].Stats.ReplicaPushes.Get() != 0 {
+		t.Fatalf("replica should not push again")
+	}
+
+	// 副本节点已经有更新的值时拒绝写入 不计为推送失败
+	groups["a:3"].replicate(key, ByteView{s: "old", ver: 1})
+	for groups["a:3"].Stats.ReplicaRejected.Get() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("older value should be rejected by replica")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if groups["a:3"].Stats.ReplicaErrs.Get() != 0 {
+		t.Fatalf("rejection should not count as replica error")
+	}
+	if v, _ := groups["b:3"].mainCache.peek(key); v.String() != "v"+key {
+		t.Fatalf("replica should keep the newer value, got %q", v.String())
+	}
+	// 副本节点都被剔除时 没有推送任何值 不计入推送成功
+	b := servers["a:3"].clients["b:3"].breaker
+	b.mu.Lock()
+	b.trip()
+	b.mu.Unlock()
+	if err := servers["a:3"].Replicate(context.Background(), "cluster", key, StringView("v"), 1); !errors.Is(err, ErrNoReplicas) {
+		t.Fatalf("replicate without targets should fail, got %v", err)
+	}
+	pushes := groups["a:3"].Stats.ReplicaPushes.Get()
+	groups["a:3"].replicate(key, StringView("v"))
+	time.Sleep(20 * time.Millisecond)
+	if groups["a:3"].Stats.ReplicaPushes.Get() != pushes {
+		t.Fatalf("push without targets should not be counted")
+	}
+}
+
+// 带有过期时间时 副本只接受更新的值
+func TestAcceptReplica(t *testing.T) {
+	g := NewGroup("replica", 0, GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	now := time.Now()
+	entry := func(value string, expire time.Time) *gpb.Entry {
+		return &gpb.Entry{Key: "k", Value: []byte(value), Expire: expire.UnixNano()}
+	}
+	if !g.acceptReplica(entry("new", now.Add(time.Minute)), now) {
+		t.Fatalf("first replica should be accepted")
+	}
+	if g.acceptReplica(entry("old", now.Add(time.Second)), now) {
+		t.Fatalf("older replica should be rejected")
+	}
+	if g.acceptReplica(entry("expired", now.Add(-time.Second)), now) {
+		t.Fatalf("expired replica should be rejected")
+	}
+	if v, _ := g.mainCache.get("k"); v.String() != "new" {
+		t.Fatalf("newer value should be kept, got %q", v.String())
+	}
+	// 带有版本号时按版本号比较
+	v, _ := g.mainCache.get("k")
+	older := entry("older", now.Add(time.Hour))
+	older.Version = v.ver - 1
+	if g.acceptReplica(older, now) {
+		t.Fatalf("replica with older version should be rejected")
+	}
+	newer := entry("newer", now.Add(time.Second))
+	newer.Version = v.ver + 1
+	if !g.acceptReplica(newer, now) {
+		t.Fatalf("replica with newer version should be accepted")
+	}
+}
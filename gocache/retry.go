@@ -0,0 +1,119 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 访问节点失败时的重试策略
+type RetryPolicy struct {
+	// 最多请求的次数 包括第一次 小于等于1表示不重试
+	MaxAttempts int
+	// 第一次重试前的等待时间 之后每次乘以Multiplier 不超过MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// 等待时间随机浮动的比例 0到1之间 避免所有节点同时重试
+	Jitter float64
+	// 可以重试的grpc状态码
+	RetryableCodes []codes.Code
+}
+
+// 默认的重试策略 只重试节点暂时不可用
+// 所有请求共用调用方的ctx 超时之后重试也会立即失败 所以不重试DeadlineExceeded
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableCodes: []codes.Code{codes.Unavailable},
+}
+
+func (p RetryPolicy) retryable(code codes.Code) bool {
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 第attempt次请求失败后的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(d)
+}
+
+// 按策略执行fn 返回请求的次数和最后一次的错误 ctx结束后不再重试
+func (p RetryPolicy) do(ctx context.Context, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(errorCode(err)) || ctx.Err() != nil {
+			return attempt, err
+		}
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// 访问节点失败时返回的错误 保留了grpc的状态码
+// 可以通过errors.As获取 也可以直接使用status.Code获取状态码
+type PeerError struct {
+	Peer     string
+	Group    string
+	Key      string
+	Code     codes.Code
+	Attempts int
+	Err      error
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("can not get %s/%s from peer %s (%s after %d attempts): %v",
+		e.Group, e.Key, e.Peer, e.Code, e.Attempts, e.Err)
+}
+
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// 实现grpc的接口 status.FromError和status.Code可以识别
+func (e *PeerError) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Error())
+}
+
+// 获取错误对应的grpc状态码 ctx的错误转换为对应的状态码
+func errorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	return codes.Unknown
+}
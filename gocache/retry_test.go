@@ -0,0 +1,92 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	}
+	for i := 1; i < 5; i++ {
+		if d := policy.backoff(i); d < time.Millisecond/2 || d > 3*time.Millisecond {
+			t.Fatalf("backoff %d out of range: %v", i, d)
+		}
+	}
+
+	// 节点不可用时重试 成功后停止
+	calls := 0
+	attempts, err := policy.do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("should succeed on third attempt, got %d %v", attempts, err)
+	}
+
+	// 超时按DeadlineExceeded处理 达到最大次数后返回最后的错误
+	attempts, err = policy.do(context.Background(), func() error {
+		return context.DeadlineExceeded
+	})
+	if attempts != 3 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("should stop after MaxAttempts, got %d %v", attempts, err)
+	}
+
+	// ctx已经超时时不再重试
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	attempts, _ = policy.do(ctx, func() error { return ctx.Err() })
+	if attempts != 1 {
+		t.Fatalf("expired ctx should not be retried, got %d attempts", attempts)
+	}
+	if DefaultRetryPolicy.retryable(codes.DeadlineExceeded) {
+		t.Fatalf("default policy should not retry DeadlineExceeded")
+	}
+
+	// 不存在和其他错误不重试
+	for _, e := range []error{ErrNotFound, status.Error(codes.Internal, "internal")} {
+		attempts, err = policy.do(context.Background(), func() error { return e })
+		if attempts != 1 || err != e {
+			t.Fatalf("%v should not be retried, got %d attempts", e, attempts)
+		}
+	}
+
+	// 零值策略不重试
+	attempts, _ = RetryPolicy{}.do(context.Background(), func() error {
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	if attempts != 1 {
+		t.Fatalf("zero policy should not retry, got %d attempts", attempts)
+	}
+}
+
+// PeerError保留grpc状态码
+func TestPeerError(t *testing.T) {
+	inner := status.Error(codes.Unavailable, "connection refused")
+	var err error = &PeerError{Peer: "gocache/b:1", Group: "scores", Key: "Tom", Code: errorCode(inner), Attempts: 3, Err: inner}
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("status code should be preserved, got %v", status.Code(err))
+	}
+	var pe *PeerError
+	if !errors.As(err, &pe) || pe.Attempts != 3 || errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected peer error %v", err)
+	}
+	if errorCode(context.Canceled) != codes.Canceled {
+		t.Fatalf("context canceled should map to Canceled")
+	}
+}
@@ -0,0 +1,100 @@
+package gocache
+
+import (
+	"context"
+	gpb "goCache/gocache/gocachepb"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+	遍历缓存
+	每次在锁内从有序索引中复制一页key和值 处理这一页时不持有锁 所以遍历期间可以读写缓存
+	遍历期间删除的key如果还没有复制就不会出现 新增的key排在当前位置之后时会被遍历到
+	只遍历mainCache hotCache中是其他节点负责的key 已经过期的值不返回
+*/
+
+const (
+	// Range每次复制的数量
+	scanPageSize = 256
+	// Scan每页默认和最大的数量
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// 按字典序分页返回以prefix开头并且大于cursor的key 最多返回limit个 limit<=0表示不限制
+// 还有更多的key时next为本页最后一个key 作为下一次的cursor 否则为空字符串
+// 过期的key不返回 所以一页的数量可能少于limit
+func (g *Group) Keys(prefix, cursor string, limit int) (keys []string, next string) {
+	keys, _, next = g.scan(prefix, cursor, limit)
+	return
+}
+
+// 按字典序遍历以prefix开头的key和值 fn返回false时停止 调用fn时不持有锁
+func (g *Group) Range(prefix string, fn func(key string, value ByteView) bool) error {
+	cursor := ""
+	for {
+		keys, values, next := g.scan(prefix, cursor, scanPageSize)
+		for i, key := range keys {
+			v, err := decode(values[i])
+			if err != nil {
+				return err
+			}
+			if !fn(key, v) {
+				return nil
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// 返回一页没有过期的key和存储形式的值
+func (g *Group) scan(prefix, cursor string, limit int) ([]string, []ByteView, string) {
+	keys, values, next := g.mainCache.scan(prefix, cursor, limit)
+	now := time.Now()
+	n := 0
+	for i := range keys {
+		if values[i].fresh(now) {
+			keys[n], values[n] = keys[i], values[i]
+			n++
+		}
+	}
+	return keys[:n], values[:n], next
+}
+
+// 实现Scan接口 分页列出缓存中的key
+func (p *Server) Scan(ctx context.Context, in *gpb.ScanRequest) (*gpb.ScanResponse, error) {
+	g := p.getGroup(in.Group)
+	if g == nil {
+		return nil, status.Errorf(codes.NotFound, "No this group %s", in.Group)
+	}
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	if limit > maxScanLimit {
+		limit = maxScanLimit
+	}
+	keys, values, next := g.scan(in.Prefix, in.Cursor, limit)
+	resp := &gpb.ScanResponse{NextCursor: next}
+	for i, key := range keys {
+		entry := &gpb.Entry{Key: key}
+		if in.Values {
+			v, err := g.wireView(values[i])
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "encode %s/%s: %v", in.Group, key, err)
+			}
+			entry.Value, entry.Compression, entry.Version, entry.Tags = v.bytes(), v.c, v.ver, v.tags
+			if !v.e.IsZero() {
+				entry.Expire = v.e.UnixNano()
+			}
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	return resp, nil
+}
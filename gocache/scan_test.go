@@ -0,0 +1,88 @@
+package gocache
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	gpb "goCache/gocache/gocachepb"
+)
+
+func TestGroupKeys(t *testing.T) {
+	g := NewGroup("scan-keys", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v" + key), nil
+	}))
+	var want []string
+	for i := 0; i < 25; i++ {
+		key := "user:" + strconv.Itoa(100+i)
+		want = append(want, key)
+		g.Get(key)
+	}
+	g.Get("order:1")
+	g.populateCache("user:099", ByteView{s: "expired", e: time.Now().Add(-time.Second)})
+
+	var got []string
+	cursor := ""
+	for {
+		keys, next := g.Keys("user:", cursor, 10)
+		got = append(got, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("paged keys = %v, want %v", got, want)
+	}
+}
+
+// 遍历时不持有锁 fn中可以读写缓存
+func TestGroupRange(t *testing.T) {
+	g := NewGroup("scan-range", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v" + key), nil
+	}))
+	for i := 0; i < scanPageSize+10; i++ {
+		g.Get("k" + strconv.Itoa(1000+i))
+	}
+	var n int
+	err := g.Range("k", func(key string, value ByteView) bool {
+		if value.String() != "v"+key {
+			t.Fatalf("value of %s = %q", key, value.String())
+		}
+		// 删除还没有复制的最后一个key
+		if n == 0 {
+			g.mainCache.remove("k" + strconv.Itoa(1000+scanPageSize+9))
+		}
+		g.Get(key)
+		n++
+		return true
+	})
+	if err != nil || n != scanPageSize+9 {
+		t.Fatalf("Range visited %d keys, err %v", n, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	addrs := []string{"a:5", "b:5"}
+	servers, groups, _ := startCluster(t, addrs, nil)
+	for _, key := range []string{"x:1", "x:2", "x:3", "y:1"} {
+		groups["b:5"].populateCache(key, StringView("v"+key))
+	}
+	servers["a:5"].Set(addrs...)
+	client := servers["a:5"].clients["b:5"].getter.(bufPeer).client
+	req := &gpb.ScanRequest{Group: "cluster", Prefix: "x:", Limit: 2, Values: true}
+	resp, err := client.Scan(context.Background(), req)
+	if err != nil || len(resp.Entries) != 2 || resp.NextCursor != "x:2" || string(resp.Entries[1].Value) != "vx:2" {
+		t.Fatalf("first page = %v, %v", resp, err)
+	}
+	req.Cursor, req.Values = resp.NextCursor, false
+	resp, err = client.Scan(context.Background(), req)
+	if err != nil || len(resp.Entries) != 1 || resp.Entries[0].Key != "x:3" || resp.Entries[0].Value != nil || resp.NextCursor != "" {
+		t.Fatalf("second page = %v, %v", resp, err)
+	}
+	if _, err := client.Scan(context.Background(), &gpb.ScanRequest{Group: "missing"}); err == nil {
+		t.Fatalf("unknown group should fail")
+	}
+}
@@ -29,6 +29,10 @@ import (
 const (
 	// defaultgrpcBasePath = "/gocache/"
 	defaultgrpcReolicas = 50
+	// grpc默认的最大消息大小
+	defaultMaxMsgSize = 4 << 20
+	// GetStream每个分块的大小
+	defaultChunkSize = 1 << 20
 )
 
 // 配置etcd客户端默认配置
@@ -53,18 +57,125 @@ type Server struct {
 	// 互斥锁
 	mu sync.Mutex
 	// hash算法
-	peers *consistenthash.Map
-	// TODO:实现一个grpc的client 并用map进行映射
-	clients map[string]*Client
+	peers consistenthash.Placement
+	// 创建节点选择算法 默认为带虚拟节点的哈希环
+	newPlacement func() consistenthash.Placement
+	// 每个节点对应的client 外面包装了一层熔断器
+	clients map[string]*breakerPeer
+	// 熔断器配置
+	breakerConfig BreakerConfig
+	// 访问其他节点失败时的重试策略
+	retryPolicy RetryPolicy
+	// 创建访问节点的PeerGetter 默认为grpc的Client 测试时可以替换
+	newGetter func(peer string) PeerGetter
+	// 接收和发送的最大消息大小 同时用于grpc服务端和连接其他节点的客户端
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	// GetStream每个分块的大小
+	chunkSize int
+	// 快照配置 为nil表示不保存快照
+	snapshot *SnapshotConfig
+	// 通知定期保存快照的协程停止
+	snapshotStop chan struct{}
+	// 对外提供的group 为nil表示所有通过NewGroup创建的group
+	groups map[string]*Group
+	// 哈希环变化时的交接配置 为nil表示不交接
+	handoff *HandoffConfig
+	// 有界负载的倍数 0表示不限制节点负载
+	loadFactor float64
+	// 当前节点正在处理的请求数
+	inflight AtomicInt
+	// 失效通知的重试配置和等待重试的通知
+	invalidation  InvalidationConfig
+	invalidations invalidationQueue
+}
+
+// 创建Server时的可选配置
+type ServerOption func(*Server)
+
+// 设置接收和发送的最大消息大小
+func WithMaxMsgSize(recv, send int) ServerOption {
+	return func(p *Server) {
+		p.maxRecvMsgSize = recv
+		p.maxSendMsgSize = send
+	}
+}
+
+// 设置节点熔断器的配置
+func WithBreaker(cfg BreakerConfig) ServerOption {
+	return func(p *Server) {
+		p.breakerConfig = cfg
+	}
+}
+
+// 设置访问其他节点失败时的重试策略
+func WithRetryPolicy(policy RetryPolicy) ServerOption {
+	return func(p *Server) {
+		p.retryPolicy = policy
+	}
+}
+
+// 只对外提供指定的group 同一个进程中运行多个节点时 每个节点可以使用自己的group
+func WithGroups(groups ...*Group) ServerOption {
+	return func(p *Server) {
+		p.groups = make(map[string]*Group, len(groups))
+		for _, g := range groups {
+			p.groups[g.name] = g
+		}
+	}
+}
+
+// 开启有界负载的一致性哈希 每个节点的负载不超过平均负载的factor倍 例如1.25
+// 负载使用当前节点正在处理的请求数 以及发往其他节点还没有返回的请求数
+func WithBoundedLoad(factor float64) ServerOption {
+	return func(p *Server) {
+		p.loadFactor = factor
+	}
+}
+
+// 设置节点选择算法 所有节点需要使用相同的算法
+// 例如 WithPlacement(func() consistenthash.Placement { return consistenthash.NewMaglev(0, nil) })
+func WithPlacement(newPlacement func() consistenthash.Placement) ServerOption {
+	return func(p *Server) {
+		p.newPlacement = newPlacement
+	}
+}
+
+// 设置GetStream每个分块的大小
+func WithChunkSize(n int) ServerOption {
+	return func(p *Server) {
+		p.chunkSize = n
+	}
 }
 
 // 实现Server的new函数
-func NewServer(self string) (*Server, error) {
-	return &Server{
-		self:    self,
-		peers:   consistenthash.New(defaultgrpcReolicas, nil),
-		clients: map[string]*Client{},
-	},nil
+func NewServer(self string, opts ...ServerOption) (*Server, error) {
+	p := &Server{
+		self:           self,
+		clients:        map[string]*breakerPeer{},
+		breakerConfig:  DefaultBreakerConfig,
+		retryPolicy:    DefaultRetryPolicy,
+		invalidation:   DefaultInvalidationConfig,
+		maxRecvMsgSize: defaultMaxMsgSize,
+		maxSendMsgSize: defaultMaxMsgSize,
+		chunkSize:      defaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.newGetter == nil {
+		p.newGetter = p.newClient
+	}
+	if p.newPlacement == nil {
+		p.newPlacement = func() consistenthash.Placement {
+			return consistenthash.New(defaultgrpcReolicas, nil)
+		}
+	}
+	p.peers = p.newPlacement()
+	if p.chunkSize <= 0 || p.chunkSize > p.maxSendMsgSize {
+		return nil, fmt.Errorf("invalid chunk size %d", p.chunkSize)
+	}
+	return p, nil
 }
 func (p *Server) Log(format string, v ...interface{}) {
 	log.Printf("[GrpcServer %s] %s", p.self, fmt.Sprintf(format, v...))
@@ -95,13 +206,22 @@ func (p *Server) Start() error {
 	// ----------------------------------------------
 	p.status = true
 	p.stopSignal = make(chan error)
+	// 注册到etcd之前先恢复快照
+	if p.snapshot != nil {
+		p.restoreSnapshots()
+		p.snapshotStop = make(chan struct{})
+		go p.snapshotLoop(p.snapshotStop)
+	}
 
 	port := strings.Split(p.self, ":")[1]
 	lis, err := net.Listen("tcp", ":"+port) //监听指定的 TCP 端口，用于接受客户端的 gRPC 请求
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.MaxRecvMsgSize(p.maxRecvMsgSize),
+		grpc.MaxSendMsgSize(p.maxSendMsgSize),
+	)
 	gpb.RegisterGroupCacheServer(grpcServer, p)
 	//创建一个新的 gRPC 服务器 grpcServer，然后将当前的 Server 对象 s 注册为 gRPC 服务。
 	//这样，gRPC 服务器就能够处理来自客户端的请求。
@@ -137,21 +257,22 @@ func (p *Server) Start() error {
 func (p *Server) Get(ctx context.Context, in *gpb.Request) (*gpb.Response, error) {
 	// 和http一样 先获取到需要groupname和key
 	group, key := in.Group, in.Key
-	// 定义返回值
-	resp := &gpb.Response{}
 	log.Printf("[gocache_svr %s] Recv RPC Request - (%s)/(%s)", p.self, group, key)
-	// 有了group的name就可以获取到对应的缓存group
-	g := GetGroup(group)
-	if g == nil {
-		return resp, fmt.Errorf("No this group")
+	p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	view, err := p.lookup(in)
+	if in.WireVersion >= wireVersion {
+		// 新版本客户端 直接返回值 处理结果放在status中
+		return newResponse(view, err), nil
 	}
-	// 接着获取对应的值
-	view, err := g.Get(key)
+	// 旧版本客户端 保持原来的格式 滚动升级期间仍然可以访问
+	resp := &gpb.Response{}
 	if err != nil {
 		return resp, err
 	}
 	//将获取到的缓存数据序列化为 protobuf 格式，并存储在响应对象的 Value 字段中
-	body, err := proto.Marshal(&gpb.Response{Value: view.ByteSlice()})
+	// 序列化只读取数据 直接使用底层切片 避免复制整个值
+	body, err := proto.Marshal(&gpb.Response{Value: view.bytes(), Compression: view.c})
 	if err != nil {
 		log.Printf("encoding response body:%v", err)
 	}
@@ -159,31 +280,218 @@ func (p *Server) Get(ctx context.Context, in *gpb.Request) (*gpb.Response, error
 	return resp, nil
 }
 
-// 实现set方法 实例化hash算法 并添加传入的节点
+// 获取请求的group中key对应的值 返回传输时的形式
+func (p *Server) lookup(in *gpb.Request) (ByteView, error) {
+	// 有了group的name就可以获取到对应的缓存group
+	g := p.getGroup(in.Group)
+	if g == nil {
+		return ByteView{}, fmt.Errorf("No this group")
+	}
+	// 接着获取对应的值 这里拿到的是缓存中的存储形式 避免先解压再压缩
+	// 故障转移过来的请求不再转发给其他节点
+	get := g.get
+	if in.Failover {
+		get = g.getNoForward
+	}
+	view, err := get(in.Key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	// 按group的配置决定传输时是否压缩
+	return g.wireView(view)
+}
+
+// 实现GetStream接口 将值分块发送 不受单个消息大小的限制
+func (p *Server) GetStream(in *gpb.Request, stream gpb.GroupCache_GetStreamServer) error {
+	group, key := in.Group, in.Key
+	log.Printf("[gocache_svr %s] Recv RPC Stream Request - (%s)/(%s)", p.self, group, key)
+	p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	view, err := p.lookup(in)
+	if err != nil {
+		return streamStatus(err)
+	}
+	// 第一个分块携带总大小、压缩算法、版本号和标签 即使值为空也至少发送一个分块
+	chunk := &gpb.Chunk{Size: int64(view.Len()), Compression: view.c, Version: view.ver, Tags: view.tags}
+	for from := 0; from == 0 || from < view.Len(); from += p.chunkSize {
+		to := from + p.chunkSize
+		if to > view.Len() {
+			to = view.Len()
+		}
+		chunk.Data = view.Slice(from, to).bytes()
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+		chunk = &gpb.Chunk{}
+	}
+	return nil
+}
+
+// 根据名称获取对外提供的group
+func (p *Server) getGroup(name string) *Group {
+	if p.groups != nil {
+		return p.groups[name]
+	}
+	return GetGroup(name)
+}
+
+// 返回所有对外提供的group
+func (p *Server) groupList() []*Group {
+	if p.groups == nil {
+		return allGroups()
+	}
+	list := make([]*Group, 0, len(p.groups))
+	for _, g := range p.groups {
+		list = append(list, g)
+	}
+	return list
+}
+
+// 实现set方法 使用传入的节点重新构建哈希环
+// peers是完整的节点列表(包括自身) 不在列表中的节点会被移除 增加节点时使用Add
+// 开启交接时 把不再由自身负责的key发送给新的owner
 func (p *Server) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.set(peers)
+}
+
+// 在当前的节点列表中增加节点 已经存在的节点保持不变
+func (p *Server) Add(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[string]bool, len(p.clients)+len(peers))
+	all := make([]string, 0, len(p.clients)+len(peers))
+	for peer := range p.clients {
+		seen[peer] = true
+		all = append(all, peer)
+	}
+	for _, peer := range peers {
+		if !seen[peer] {
+			seen[peer] = true
+			all = append(all, peer)
+		}
+	}
+	p.set(all)
+}
+
+// 调用时需要持有锁
+func (p *Server) set(peers []string) {
+	old := p.peers
+	p.peers = p.newPlacement()
 	p.peers.Add(peers...)
-	// TODO:将客户端映射到map中
+	// 将客户端映射到map中 每个节点对应一个熔断器 仍然存在的节点保留原来的客户端
+	clients := make(map[string]*breakerPeer, len(peers))
 	for _, peer := range peers {
-		service := fmt.Sprintf("gocache/%s", peer) 
-		p.clients[peer] = NewClient(service)
+		if c, ok := p.clients[peer]; ok {
+			clients[peer] = c
+			continue
+		}
+		clients[peer] = &breakerPeer{
+			getter:  p.newGetter(peer),
+			breaker: newCircuitBreaker(p.breakerConfig),
+		}
+	}
+	p.clients = clients
+	if p.handoff != nil {
+		go p.handoffKeys(old, p.peers)
 	}
 }
 
+// 创建访问节点的grpc客户端
+func (p *Server) newClient(peer string) PeerGetter {
+	service := fmt.Sprintf("gocache/%s", peer)
+	c := NewClient(service, grpc.WithDefaultCallOptions(
+		grpc.MaxCallRecvMsgSize(p.maxRecvMsgSize),
+		grpc.MaxCallSendMsgSize(p.maxSendMsgSize),
+	))
+	c.SetRetryPolicy(p.retryPolicy)
+	return c
+}
+
 // 实现http.go中对应的pickpeer方法
-// TODO:解决gRPC客户端调用，hash映射到远程节点调用没有返回值问题
+// owner被熔断器剔除或者负载达到上限时 沿哈希环选择下一个可用的节点
 func (p *Server) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	nodes := p.peers.GetN(key, len(p.clients))
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	owner := nodes[0]
+	if p.loadFactor > 0 {
+		nodes = consistenthash.GetNBounded(p.peers, key, len(p.clients), p.loadFactor, p.load)
+	}
+	for _, peer := range nodes {
+		if peer == p.self {
+			return nil, false
+		}
+		c := p.clients[peer]
+		if c.breaker.ejected() {
+			p.Log("Skip ejected peer %s", peer)
+			continue
+		}
 		p.Log("Pick peer %s", peer)
-		// TODO:
-		return p.clients[peer], true
+		if peer != owner {
+			return failoverPeer{c}, true
+		}
+		return c, true
 	}
 	return nil, false
 }
 
+// 节点当前的负载 调用时需要持有锁
+func (p *Server) load(peer string) int64 {
+	if peer == p.self {
+		return p.inflight.Get()
+	}
+	if c, ok := p.clients[peer]; ok {
+		return c.inflight.Get()
+	}
+	return 0
+}
+
+// 实现OwnerPicker 哈希环为空时认为自身负责所有key
+func (p *Server) Owns(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	owner := p.peers.Get(key)
+	return owner == "" || owner == p.self
+}
+
+// 实现FailoverPicker 沿哈希环返回owner之后的后继节点 遇到自身时停止
+func (p *Server) PickFailover(key string, n int) ([]PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	nodes := p.peers.GetN(key, n+1)
+	var peers []PeerGetter
+	for i := 1; i < len(nodes); i++ {
+		if nodes[i] == p.self {
+			return peers, true
+		}
+		if p.clients[nodes[i]].breaker.ejected() {
+			p.Log("Skip ejected peer %s", nodes[i])
+			continue
+		}
+		p.Log("Pick failover peer %s", nodes[i])
+		peers = append(peers, p.clients[nodes[i]])
+	}
+	return peers, false
+}
+
+// 返回每个节点熔断器的状态
+func (p *Server) PeerStats() map[string]BreakerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]BreakerStats, len(p.clients))
+	for peer, c := range p.clients {
+		if peer != p.self {
+			stats[peer] = c.breaker.stats()
+		}
+	}
+	return stats
+}
+
 func (p *Server)Stop(){
 	p.mu.Lock()
 	if p.status == false{
@@ -198,5 +506,14 @@ func (p *Server)Stop(){
 	p.clients = nil
 	p.clients = nil
 	p.mu.Unlock()
+	if p.snapshot != nil {
+		close(p.snapshotStop)
+		p.saveSnapshots()
+	}
+	p.stopInvalidations()
 }
 var _ PeerPicker = (*Server)(nil)
+var _ FailoverPicker = (*Server)(nil)
+var _ OwnerPicker = (*Server)(nil)
+var _ Replicator = (*Server)(nil)
+var _ InvalidationPublisher = (*Server)(nil)
@@ -7,10 +7,23 @@
 package gocache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"goCache/gocache/consistenthash"
+	gpb "goCache/gocache/gocachepb"
 	"log"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 func ceateTestServer() (*Group, *Server) {
@@ -63,3 +76,167 @@ func TestServer_GetKey(t *testing.T) {
 		}
 	}
 }
+
+// 使用内存中的连接启动grpc服务 不依赖etcd
+func startBufServer(t *testing.T, svr *Server) gpb.GroupCacheClient {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	gpb.RegisterGroupCacheServer(grpcServer, svr)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return gpb.NewGroupCacheClient(conn)
+}
+
+// 测试分块获取超过grpc默认消息大小限制的大值
+func TestServer_GetStream(t *testing.T) {
+	value := strings.Repeat("gocache", 1<<20)
+	NewGroup("large", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(value), nil
+		}))
+	svr, err := NewServer("localhost:9998", WithChunkSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := startBufServer(t, svr)
+	ctx := context.Background()
+	req := &gpb.Request{Group: "large", Key: "key"}
+
+	if _, err := client.Get(ctx, req); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("unary get of large value should exceed message size, got %v", err)
+	}
+	out := &gpb.Response{}
+	if err := NewClient("large").getStream(ctx, client, req, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Value) != value {
+		t.Fatalf("stream value mismatch, got %d bytes want %d", len(out.Value), len(value))
+	}
+}
+
+// 测试新旧两种传输格式
+func TestServer_WireVersion(t *testing.T) {
+	NewGroup("wire", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}))
+	svr, _ := NewServer("localhost:9997")
+	client := startBufServer(t, svr)
+	ctx := context.Background()
+
+	// 旧版本客户端 value中是序列化后的Response
+	req := &gpb.Request{Group: "wire", Key: "Tom"}
+	resp, err := client.Get(ctx, req)
+	if err != nil || resp.WireVersion != 0 {
+		t.Fatalf("legacy request should get legacy response: %v %v", resp, err)
+	}
+	out := &gpb.Response{}
+	if err := decodeResponse(req, resp, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("decode legacy response failed: %v %v", out, err)
+	}
+
+	// 新版本客户端
+	req.WireVersion = wireVersion
+	resp, err = client.Get(ctx, req)
+	if err != nil || resp.WireVersion != wireVersion || resp.Status != gpb.Status_OK || string(resp.Value) != "630" {
+		t.Fatalf("versioned response mismatch: %v %v", resp, err)
+	}
+	req.Key = "Unknown"
+	resp, err = client.Get(ctx, req)
+	if err != nil || resp.Status != gpb.Status_NOT_FOUND {
+		t.Fatalf("missing key should be NOT_FOUND: %v %v", resp, err)
+	}
+	if err := decodeResponse(req, resp, out); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("NOT_FOUND should decode to ErrNotFound, got %v", err)
+	}
+
+	// 分块获取时通过NOT_FOUND状态码传递
+	stream, err := client.GetStream(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Fatalf("streamed miss should be NOT_FOUND, got %v", err)
+	}
+	if err := NewClient("wire").getStream(ctx, client, req, out); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("streamed miss should decode to ErrNotFound, got %v", err)
+	}
+}
+
+// 有界负载时跳过负载达到上限的owner
+func TestServer_PickPeerBoundedLoad(t *testing.T) {
+	svr, _ := NewServer("a:1", WithBoundedLoad(1.25))
+	svr.newGetter = func(peer string) PeerGetter { return &fakePeer{value: peer} }
+	svr.Set("a:1", "b:1", "c:1")
+	var key string
+	for i := 0; ; i++ {
+		key = strconv.Itoa(i)
+		if nodes := svr.peers.GetN(key, 3); nodes[0] == "b:1" && nodes[1] == "c:1" {
+			break
+		}
+	}
+	if peer, ok := svr.PickPeer(key); !ok || peer != PeerGetter(svr.clients["b:1"]) {
+		t.Fatalf("owner b should be picked without load")
+	}
+	// 总负载4 上限为ceil(1.25*5/3)=3
+	svr.clients["b:1"].inflight.Add(3)
+	svr.inflight.Add(1)
+	peer, ok := svr.PickPeer(key)
+	if !ok {
+		t.Fatalf("c should be picked")
+	}
+	in, out := &gpb.Request{}, &gpb.Response{}
+	if err := peer.Get(context.Background(), in, out); err != nil || string(out.Value) != "c:1" || !in.Failover {
+		t.Fatalf("request should go to c as failover, got %q %v", out.Value, err)
+	}
+	// b和c都达到上限时由当前节点处理 总负载11 上限为ceil(1.25*12/3)=5
+	svr.clients["b:1"].inflight.Add(2)
+	svr.clients["c:1"].inflight.Add(5)
+	if _, ok := svr.PickPeer(key); ok {
+		t.Fatalf("key should be loaded locally when b and c are saturated")
+	}
+}
+
+// 使用其他节点选择算法
+// Set替换整个节点列表 Add在已有的节点上增加
+func TestServer_SetAdd(t *testing.T) {
+	svr, _ := NewServer("a:1")
+	svr.newGetter = func(peer string) PeerGetter { return &fakePeer{value: peer} }
+	svr.Set("a:1", "b:1")
+	b := svr.clients["b:1"]
+	svr.Add("c:1", "b:1", "c:1")
+	if len(svr.clients) != 3 || svr.clients["b:1"] != b || svr.peers.Len() != 3 {
+		t.Fatalf("Add should keep existing peers, got %v", svr.clients)
+	}
+	svr.Set("a:1", "c:1")
+	if _, ok := svr.clients["b:1"]; ok || len(svr.clients) != 2 || svr.peers.Len() != 2 {
+		t.Fatalf("Set should replace the peer list, got %v", svr.clients)
+	}
+}
+
+func TestServer_Placement(t *testing.T) {
+	jump := consistenthash.NewJump(nil)
+	jump.Add("a:1", "b:1", "c:1")
+	svr, _ := NewServer("a:1", WithPlacement(func() consistenthash.Placement { return consistenthash.NewJump(nil) }))
+	svr.newGetter = func(peer string) PeerGetter { return &fakePeer{value: peer} }
+	svr.Set("c:1", "b:1", "a:1")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		peer, ok := svr.PickPeer(key)
+		if owner := jump.Get(key); ok != (owner != "a:1") || ok && peer != PeerGetter(svr.clients[owner]) {
+			t.Fatalf("key %s should be owned by %s", key, owner)
+		}
+	}
+}
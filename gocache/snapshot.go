@@ -0,0 +1,312 @@
+package gocache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "goCache/gocache/gocachepb"
+)
+
+/*
+	快照格式 所有整数都是大端序:
+	  magic       4字节 "GCSN"
+	  version     uint16 当前为2
+	  count       uint32 条目数量
+	  count个条目 按从最久未访问到最近访问的顺序:
+	    keyLen      uvarint
+	    key         keyLen字节
+	    compression uint8 值的压缩算法 对应pb.Compression
+	    expire      varint 过期时间 unix纳秒 0表示永不过期
+	    valueLen    uvarint
+	    value       valueLen字节
+	    tagCount    uvarint 版本2新增 之后是tagCount个标签 每个标签为uvarint长度和内容
+	  checksum    uint32 之前所有字节的CRC-32C
+	只保存mainCache中的值 hotCache中是其他节点负责的key 不保存。
+	版本1的快照没有标签 仍然可以恢复。
+*/
+
+const (
+	snapshotMagic   = "GCSN"
+	snapshotVersion = 2
+	// 恢复时单个key和value的最大长度 防止损坏的文件申请过大的内存
+	maxSnapshotField = 1 << 30
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// 快照文件格式错误或者校验失败
+var ErrBadSnapshot = errors.New("gocache: bad snapshot")
+
+// 将mainCache中的内容写入w
+func (g *Group) Snapshot(w io.Writer) error {
+	keys, values := g.mainCache.entries()
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	var buf [binary.MaxVarintLen64]byte
+	bw.WriteString(snapshotMagic)
+	binary.Write(bw, binary.BigEndian, uint16(snapshotVersion))
+	binary.Write(bw, binary.BigEndian, uint32(len(keys)))
+	for i, key := range keys {
+		v := values[i]
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+		bw.WriteString(key)
+		bw.WriteByte(byte(v.c))
+		var expire int64
+		if !v.e.IsZero() {
+			expire = v.e.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf[:], expire)])
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(v.Len()))])
+		if v.b != nil {
+			bw.Write(v.b)
+		} else {
+			bw.WriteString(v.s)
+		}
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(v.tags)))])
+		for _, tag := range v.tags {
+			bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(tag)))])
+			bw.WriteString(tag)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// 从r中读取快照并写入mainCache 已经过期的值和已经在缓存中的key会被跳过
+// 校验通过后才会写入缓存 文件损坏时缓存保持不变
+func (g *Group) Restore(r io.Reader) error {
+	crc := crc32.New(crcTable)
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc}
+	magic := make([]byte, len(snapshotMagic))
+	sr.read(magic)
+	var version uint16
+	var count uint32
+	sr.readInt(&version)
+	sr.readInt(&count)
+	if sr.err == nil && (string(magic) != snapshotMagic || version < 1 || version > snapshotVersion) {
+		return fmt.Errorf("%w: unknown magic %q or version %d", ErrBadSnapshot, magic, version)
+	}
+	keys := make([]string, 0)
+	values := make([]ByteView, 0)
+	for i := uint32(0); i < count && sr.err == nil; i++ {
+		key := sr.readBytes()
+		var c [1]byte
+		sr.read(c[:])
+		expire := sr.readVarint()
+		value := sr.readBytes()
+		v := ByteView{b: value, c: pb.Compression(c[0])}
+		if version >= 2 {
+			n := sr.readUvarint()
+			for j := uint64(0); j < n && sr.err == nil; j++ {
+				v.tags = append(v.tags, string(sr.readBytes()))
+			}
+		}
+		if expire != 0 {
+			v.e = time.Unix(0, expire)
+		}
+		keys = append(keys, string(key))
+		values = append(values, v)
+	}
+	if sr.err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSnapshot, sr.err)
+	}
+	sum := crc.Sum32()
+	var checksum uint32
+	if err := binary.Read(sr.r, binary.BigEndian, &checksum); err != nil {
+		return fmt.Errorf("%w: read checksum: %v", ErrBadSnapshot, err)
+	}
+	if checksum != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	// 先转换所有的值 无法解压时不写入任何值
+	for i, key := range keys {
+		v, err := g.storageView(values[i])
+		if err != nil {
+			return fmt.Errorf("%w: decode %s: %v", ErrBadSnapshot, key, err)
+		}
+		values[i] = v
+	}
+	now := time.Now()
+	for i, key := range keys {
+		if !values[i].fresh(now) {
+			continue
+		}
+		// 例如预热时已经加载 缓存中的值更新
+		if g.mainCache.contains(key) {
+			continue
+		}
+		g.populateCache(key, values[i])
+	}
+	return nil
+}
+
+// 先写入临时文件再重命名 保证快照文件总是完整的
+func (g *Group) SnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := g.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// 从文件恢复快照
+func (g *Group) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
+
+// 读取快照 同时计算校验和 出错后不再读取
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+func (r *snapshotReader) read(p []byte) {
+	if r.err != nil {
+		return
+	}
+	if _, r.err = io.ReadFull(r.r, p); r.err == nil {
+		r.crc.Write(p)
+	}
+}
+
+func (r *snapshotReader) readInt(data interface{}) {
+	if r.err != nil {
+		return
+	}
+	r.err = binary.Read(io.TeeReader(r.r, r.crc), binary.BigEndian, data)
+}
+
+func (r *snapshotReader) readVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	var n int64
+	n, r.err = binary.ReadVarint(&byteTee{r})
+	return n
+}
+
+func (r *snapshotReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var n uint64
+	n, r.err = binary.ReadUvarint(&byteTee{r})
+	return n
+}
+
+func (r *snapshotReader) readBytes() []byte {
+	n := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > maxSnapshotField {
+		r.err = fmt.Errorf("field too large: %d bytes", n)
+		return nil
+	}
+	b := make([]byte, n)
+	r.read(b)
+	return b
+}
+
+// 逐字节读取varint时同时计算校验和
+type byteTee struct {
+	r *snapshotReader
+}
+
+func (t *byteTee) ReadByte() (byte, error) {
+	b, err := t.r.r.ReadByte()
+	if err == nil {
+		t.r.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// Server定期保存快照的配置
+type SnapshotConfig struct {
+	// 快照文件所在的目录 每个group保存为一个文件
+	Dir string
+	// 保存间隔 0表示只在Stop时保存
+	Interval time.Duration
+}
+
+// 开启快照 Start时从目录中恢复 之后定期保存 Stop时再保存一次
+func WithSnapshot(cfg SnapshotConfig) ServerOption {
+	return func(p *Server) {
+		p.snapshot = &cfg
+	}
+}
+
+func snapshotPath(dir, group string) string {
+	return filepath.Join(dir, url.PathEscape(group)+".snap")
+}
+
+// 从快照目录恢复所有group
+func (p *Server) restoreSnapshots() {
+	for _, g := range p.groupList() {
+		path := snapshotPath(p.snapshot.Dir, g.name)
+		err := g.RestoreFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			p.Log("Restore snapshot %s failed: %v", path, err)
+		default:
+			p.Log("Restored snapshot %s", path)
+		}
+	}
+}
+
+// 保存所有group的快照
+func (p *Server) saveSnapshots() {
+	if err := os.MkdirAll(p.snapshot.Dir, 0o755); err != nil {
+		p.Log("Create snapshot dir failed: %v", err)
+		return
+	}
+	for _, g := range p.groupList() {
+		path := snapshotPath(p.snapshot.Dir, g.name)
+		if err := g.SnapshotFile(path); err != nil {
+			p.Log("Save snapshot %s failed: %v", path, err)
+		}
+	}
+}
+
+func (p *Server) snapshotLoop(stop <-chan struct{}) {
+	if p.snapshot.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.snapshot.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.saveSnapshots()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package gocache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "goCache/gocache/gocachepb"
+)
+
+func TestSnapshot(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	})
+	src := NewGroup("snapshot-src", 0, getter, WithCompression(CompressionConfig{Type: pb.Compression_GZIP, Storage: true}))
+	long := string(bytes.Repeat([]byte("630"), 100))
+	src.populateCache("Tom", src.compression.encode(StringView(long)))
+	src.populateCache("Jack", ByteView{b: []byte("589"), e: time.Now().Add(time.Hour), tags: []string{"class:1"}})
+	src.populateCache("Sam", ByteView{s: "567", e: time.Now().Add(-time.Second)})
+	src.populateCache("Amy", StringView(""))
+	src.mainCache.get("Tom")
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := NewGroup("snapshot-dst", 0, getter)
+	if err := dst.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	// 恢复值和过期时间 过期的值被跳过 并保持访问顺序
+	keys, values := dst.mainCache.entries()
+	if len(keys) != 3 || keys[0] != "Jack" || keys[1] != "Amy" || keys[2] != "Tom" {
+		t.Fatalf("unexpected restored keys %v", keys)
+	}
+	if values[2].String() != long || values[2].c != pb.Compression_NONE {
+		t.Fatalf("compressed value should be restored in storage form of dst")
+	}
+	if len(values[0].tags) != 1 || values[0].tags[0] != "class:1" {
+		t.Fatalf("tags should be restored, got %v", values[0].tags)
+	}
+	if jack, _ := dst.Get("Jack"); jack.String() != "589" || jack.Expire().IsZero() {
+		t.Fatalf("expiry should be restored, got %q %v", jack.String(), jack.Expire())
+	}
+
+	// 损坏的快照不会写入缓存
+	bad := NewGroup("snapshot-bad", 0, getter)
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	if err := bad.Restore(bytes.NewReader(data)); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("corrupted snapshot should be rejected, got %v", err)
+	}
+	if err := bad.Restore(bytes.NewReader(data[:len(data)-10])); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("truncated snapshot should be rejected, got %v", err)
+	}
+	if keys, _ := bad.mainCache.entries(); len(keys) != 0 {
+		t.Fatalf("bad snapshot should not populate cache")
+	}
+
+	// 校验通过但是有值无法解压时 同样不写入任何值
+	junk := NewGroup("snapshot-junk", 0, getter)
+	junk.populateCache("Good", StringView("630"))
+	junk.populateCache("Junk", ByteView{b: []byte("not gzip"), c: pb.Compression_GZIP})
+	var junkBuf bytes.Buffer
+	if err := junk.Snapshot(&junkBuf); err != nil {
+		t.Fatal(err)
+	}
+	if err := bad.Restore(&junkBuf); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("undecodable value should be rejected, got %v", err)
+	}
+	if keys, _ := bad.mainCache.entries(); len(keys) != 0 {
+		t.Fatalf("undecodable snapshot should not populate cache, got %v", keys)
+	}
+
+	// 写入文件并恢复
+	path := filepath.Join(t.TempDir(), "scores.snap")
+	if err := src.SnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := bad.RestoreFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := bad.mainCache.get("Tom"); !ok || v.String() != long {
+		t.Fatalf("snapshot file should be restored")
+	}
+}
@@ -0,0 +1,99 @@
+package gocache
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+/*
+	过期值的使用
+	设置了有效期的缓存值过期后不会立即删除:
+	  - 过期StaleWhileRevalidate之内 直接返回旧值 同时通过singleflight在后台重新加载
+	  - 重新加载失败时(数据源或owner出错) 过期StaleIfError之内仍然返回旧值
+	数据源确认key不存在(ErrNotFound)时不会返回旧值。
+	这样可以在数据源故障期间保护数据源 并平滑刷新时的延迟。
+*/
+
+// 缓存值的有效期 owner设置的过期时间会随响应传递给其他节点
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// 过期值的使用配置
+type StaleConfig struct {
+	// 过期后多久之内可以直接返回旧值并在后台刷新
+	StaleWhileRevalidate time.Duration
+	// 过期后多久之内 重新加载失败时可以返回旧值
+	StaleIfError time.Duration
+}
+
+// 开启过期值的使用 需要配合WithTTL
+func WithStale(cfg StaleConfig) GroupOption {
+	return func(g *Group) {
+		g.stale = &cfg
+	}
+}
+
+// 处理已经过期的缓存值
+func (g *Group) getExpired(key string, stale ByteView, hot bool, now time.Time) (ByteView, error) {
+	if g.stale == nil {
+		g.hooks.miss(key)
+		value, err := g.load(key)
+		if hot {
+			g.replaceHot(key, value, err)
+		}
+		return value, err
+	}
+	age := now.Sub(stale.e)
+	if age < g.stale.StaleWhileRevalidate {
+		g.Stats.CacheHits.Add(1)
+		g.hooks.hit(key)
+		g.Stats.StaleHits.Add(1)
+		g.revalidate(key, hot)
+		return stale, nil
+	}
+	g.hooks.miss(key)
+	value, err := g.load(key)
+	if err != nil && !errors.Is(err, ErrNotFound) && age < g.stale.StaleIfError {
+		log.Printf("[gocache] serve stale %s/%s after load error: %v", g.name, key, err)
+		g.Stats.StaleOnError.Add(1)
+		return stale, nil
+	}
+	if hot {
+		g.replaceHot(key, value, err)
+	}
+	return value, err
+}
+
+// 从其他节点获取的值不会写入mainCache 过期的值在hotCache中时用新值替换 加载失败时删除
+func (g *Group) replaceHot(key string, value ByteView, err error) {
+	if err != nil {
+		g.hotCache.remove(key)
+		return
+	}
+	g.populateHotCache(key, value)
+}
+
+// 在后台重新加载key 同一个key同时只有一个刷新任务
+func (g *Group) revalidate(key string, hot bool) {
+	if _, loaded := g.revalidating.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer g.revalidating.Delete(key)
+		value, err := g.load(key)
+		if err != nil {
+			g.Stats.RevalidateErrs.Add(1)
+			log.Printf("[gocache] revalidate %s/%s failed: %v", g.name, key, err)
+			return
+		}
+		g.Stats.Revalidations.Add(1)
+		// 从其他节点获取的值不会写入mainCache 旧值在hotCache中时需要替换
+		if hot {
+			g.populateHotCache(key, value)
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package gocache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	var fail error
+	loads := make(chan string, 10)
+	g := NewGroup("stale", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if fail != nil {
+				return nil, fail
+			}
+			loads <- key
+			return []byte("new"), nil
+		}), WithTTL(time.Minute), WithStale(StaleConfig{
+		StaleWhileRevalidate: time.Second,
+		StaleIfError:         time.Hour,
+	}))
+	expired := func(age time.Duration) ByteView {
+		return ByteView{s: "old", e: time.Now().Add(-age)}
+	}
+
+	// 加载的值带有过期时间
+	if view, err := g.Get("fresh"); err != nil || view.Expire().Before(time.Now().Add(time.Second)) {
+		t.Fatalf("loaded value should expire after ttl, got %v %v", view.Expire(), err)
+	}
+	<-loads
+
+	// 刚过期时直接返回旧值 并在后台刷新
+	g.mainCache.add("k1", expired(time.Millisecond))
+	if view, err := g.Get("k1"); err != nil || view.String() != "old" {
+		t.Fatalf("should serve stale value, got %q %v", view.String(), err)
+	}
+	select {
+	case <-loads:
+	case <-time.After(time.Second):
+		t.Fatalf("stale value should be revalidated")
+	}
+	for g.Stats.Revalidations.Get() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if view, _ := g.Get("k1"); view.String() != "new" || g.Stats.StaleHits.Get() != 1 {
+		t.Fatalf("revalidated value should be cached, got %q", view.String())
+	}
+
+	// 超过StaleWhileRevalidate后同步加载 加载失败时返回旧值
+	fail = errors.New("database down")
+	g.mainCache.add("k2", expired(time.Minute))
+	if view, err := g.Get("k2"); err != nil || view.String() != "old" || g.Stats.StaleOnError.Get() != 1 {
+		t.Fatalf("should serve stale value on error, got %q %v", view.String(), err)
+	}
+
+	// 超过StaleIfError后返回错误
+	g.mainCache.add("k3", expired(2*time.Hour))
+	if _, err := g.Get("k3"); err != fail {
+		t.Fatalf("should return load error after grace period, got %v", err)
+	}
+
+	// 数据源确认不存在时不返回旧值
+	fail = ErrNotFound
+	g.mainCache.add("k4", expired(time.Minute))
+	if _, err := g.Get("k4"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("not found should not serve stale value, got %v", err)
+	}
+}
+
+// 没有开启stale时 hotCache中过期的值在重新加载后被替换
+func TestExpiredHotValue(t *testing.T) {
+	owner := &fakePeer{value: "peer"}
+	g := NewGroup("expired-hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, errors.New("database down")
+		}), WithTTL(time.Minute))
+	g.RegisterPeers(&fakePicker{owner: owner})
+
+	g.hotCache.add("k1", ByteView{s: "old", e: time.Now().Add(-time.Second)})
+	if view, err := g.Get("k1"); err != nil || view.String() != "peer" {
+		t.Fatalf("expired hot value should be reloaded, got %q %v", view.String(), err)
+	}
+	if v, ok := g.hotCache.peek("k1"); !ok || v.String() != "peer" {
+		t.Fatalf("expired hot value should be replaced, got %q %v", v.String(), ok)
+	}
+
+	// 节点和本地都加载失败时删除过期的值
+	owner.err = errors.New("unavailable")
+	g.hotCache.add("k2", ByteView{s: "old", e: time.Now().Add(-time.Second)})
+	g.Get("k2")
+	if g.hotCache.contains("k2") {
+		t.Fatalf("expired hot value should be removed after a failed load")
+	}
+}
@@ -0,0 +1,159 @@
+package gocache
+
+import (
+	"bytes"
+	"goCache/gocache/lru"
+	"sync"
+)
+
+/*
+	类型化的group
+	在Group之上通过Codec完成编解码，调用方直接使用具体类型
+	本地额外缓存解码后的对象，避免每次Get都重复解码。解码后的对象缓存有单独的容量，
+	默认为cacheBytes的1/4，可以通过WithDecodedCacheBytes修改；
+	底层缓存中的值被淘汰或者失效时，对应的对象一起删除。
+*/
+
+// 在Group的缓存之上额外缓存的数据 key从缓存中移除时一起删除
+type derivedCache interface {
+	forget(key string)
+	memoryUsage() int64
+}
+
+// 设置TypedGroup解码后对象缓存的容量 按编码后的字节数统计 小于0表示不缓存解码后的对象
+// 没有设置时为cacheBytes的1/4 对普通的Group没有作用
+func WithDecodedCacheBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.decodedBytes = n
+	}
+}
+
+// 类型化的回调函数 缓存未命中时获取数据
+type TypedGetter[T any] interface {
+	Get(key string) (T, error)
+}
+
+type TypedGetterFunc[T any] func(key string) (T, error)
+
+func (f TypedGetterFunc[T]) Get(key string) (T, error) {
+	return f(key)
+}
+
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+	// 保护decoded
+	mu sync.Mutex
+	// 解码后的对象缓存 按编码后的字节数统计容量 为nil表示不缓存
+	decoded *lru.Cache
+}
+
+// 解码后的对象 同时保存对应的字节 用于判断缓存值是否已经变化
+type decodedEntry[T any] struct {
+	view  ByteView
+	value T
+}
+
+func (e *decodedEntry[T]) Len() int {
+	return e.view.Len()
+}
+
+// 创建类型化的group 底层的Group同样会注册 可以通过GetGroup获取
+func NewTypedGroup[T any](name string, cacheBytes int64, codec Codec[T], getter TypedGetter[T], opts ...GroupOption) *TypedGroup[T] {
+	if getter == nil {
+		panic("nil TypedGetter")
+	}
+	if codec == nil {
+		panic("nil Codec")
+	}
+	t := &TypedGroup[T]{codec: codec}
+	// 不修改调用方传入的切片
+	opts = append(opts[:len(opts):len(opts)], func(g *Group) {
+		g.derived = t
+	})
+	g := NewGroup(name, cacheBytes, GetterFunc(func(key string) ([]byte, error) {
+		v, err := getter.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	}), opts...)
+	decodedBytes := g.decodedBytes
+	if decodedBytes == 0 {
+		decodedBytes = cacheBytes / 4
+	}
+	t.mu.Lock()
+	t.group = g
+	if decodedBytes >= 0 {
+		t.decoded = lru.New(decodedBytes, nil)
+		t.decoded.SetEntryOverhead(g.mainCache.entryOverhead)
+	}
+	t.mu.Unlock()
+	return t
+}
+
+// 返回底层的Group 用于注册节点等操作
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+// 获取key对应的值 返回的对象会在多次调用之间共享 调用方不要修改
+func (t *TypedGroup[T]) Get(key string) (T, error) {
+	var zero T
+	view, err := t.group.Get(key)
+	if err != nil {
+		return zero, err
+	}
+	t.mu.Lock()
+	if t.decoded != nil {
+		if v, ok := t.decoded.Get(key); ok {
+			e := v.(*decodedEntry[T])
+			if sameBytes(e.view.bytes(), view.bytes()) {
+				t.mu.Unlock()
+				return e.value, nil
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	// 解码不需要持有锁 解码器不会保留传入的字节
+	value, err := t.codec.Unmarshal(view.bytes())
+	if err != nil {
+		return zero, err
+	}
+	t.mu.Lock()
+	if t.decoded != nil {
+		t.decoded.Add(key, &decodedEntry[T]{view: view, value: value})
+	}
+	t.mu.Unlock()
+	return value, nil
+}
+
+// 底层缓存移除key时删除解码后的对象
+func (t *TypedGroup[T]) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.decoded != nil {
+		t.decoded.Remove(key)
+	}
+}
+
+func (t *TypedGroup[T]) memoryUsage() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.decoded == nil {
+		return 0
+	}
+	return t.decoded.MemoryUsage()
+}
+
+// 判断两段字节是否相同 指向同一块内存时不需要逐字节比较
+func sameBytes(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,68 @@
+package gocache
+
+import (
+	"errors"
+	"fmt"
+	gpb "goCache/gocache/gocachepb"
+	"time"
+)
+
+/*
+	版本号
+	每个缓存值都带有一个单调递增的版本号 本地加载的值使用加载开始时的版本号
+	从其他节点获取的值使用owner生成的版本号 节点之间通过Response的version和etag传递。
+	CompareAndSet只在版本号匹配时写入 并发的写入只有一个成功
+	写入和失效一样记录墓碑 写入之前开始的加载不会覆盖写入的值。
+*/
+
+// CompareAndSet时缓存中的版本号和期望的不一致
+var ErrVersionMismatch = errors.New("gocache: version mismatch")
+
+// 当前节点不是key的owner 写入只能在owner上进行
+var ErrNotOwner = errors.New("gocache: not the owner of key")
+
+// 获取key的值和版本号 版本号可以用于CompareAndSet
+func (g *Group) GetWithVersion(key string) (ByteView, uint64, error) {
+	v, err := g.Get(key)
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	return v, v.ver, nil
+}
+
+// 当key在mainCache中的版本号等于version时写入value 返回新的版本号
+// version为0表示只在key不在缓存中时写入 版本号不一致时返回包装了ErrVersionMismatch的错误
+// 只修改当前节点的缓存 必须在key的owner节点上调用 其他节点上调用时返回包装了ErrNotOwner的错误
+// 其他节点上的值通过失效通知删除
+func (g *Group) CompareAndSet(key string, value []byte, version uint64) (uint64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key is required")
+	}
+	if !g.owns(key) {
+		return 0, fmt.Errorf("%s/%s: %w", g.name, key, ErrNotOwner)
+	}
+	v := ByteView{b: cloneBytes(value), ver: nextVersion()}
+	if g.ttl > 0 {
+		v.e = time.Now().Add(g.ttl)
+	}
+	if g.compression != nil && g.compression.Storage {
+		v = g.compression.encode(v)
+	}
+	var current uint64
+	ok := g.mainCache.addIf(key, v, func(old ByteView, ok bool) bool {
+		if ok {
+			current = old.ver
+		}
+		// 期间有更新的失效时不能写入 否则会让失效之前的写入生效
+		return current == version && v.ver > g.tombstones.latest(key, nil)
+	})
+	if !ok {
+		return current, fmt.Errorf("%s/%s: expected version %d, current %d: %w", g.name, key, version, current, ErrVersionMismatch)
+	}
+	g.tombstones.add(key, scopeKey, v.ver)
+	g.hotCache.remove(key)
+	if pub, ok := g.peers.(InvalidationPublisher); ok {
+		pub.PublishInvalidation(&gpb.InvalidateRequest{Group: g.name, Key: key, Version: v.ver})
+	}
+	return v.ver, nil
+}
@@ -0,0 +1,111 @@
+package gocache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCompareAndSet(t *testing.T) {
+	g := NewGroup("cas", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v1"), nil
+	}))
+	v, ver, err := g.GetWithVersion("k")
+	if err != nil || v.String() != "v1" || ver == 0 {
+		t.Fatalf("GetWithVersion = %q, %d, %v", v.String(), ver, err)
+	}
+	if _, again, _ := g.GetWithVersion("k"); again != ver {
+		t.Fatalf("cached value should keep its version")
+	}
+	if current, err := g.CompareAndSet("k", []byte("v2"), ver+1); !errors.Is(err, ErrVersionMismatch) || current != ver {
+		t.Fatalf("wrong version should fail, got %d, %v", current, err)
+	}
+	next, err := g.CompareAndSet("k", []byte("v2"), ver)
+	if err != nil || next <= ver {
+		t.Fatalf("CompareAndSet = %d, %v", next, err)
+	}
+	if v, got, _ := g.GetWithVersion("k"); v.String() != "v2" || got != next {
+		t.Fatalf("got %q version %d, want v2 version %d", v.String(), got, next)
+	}
+	// 版本号为0表示key不存在时才写入
+	if _, err := g.CompareAndSet("new", []byte("a"), 0); err != nil {
+		t.Fatalf("create should succeed: %v", err)
+	}
+	if _, err := g.CompareAndSet("new", []byte("b"), 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("create of existing key should fail")
+	}
+}
+
+// 使用同一个版本号的并发写入只有一个成功
+func TestCompareAndSetConcurrent(t *testing.T) {
+	g := NewGroup("cas-concurrent", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}))
+	_, ver, _ := g.GetWithVersion("k")
+	var (
+		wg   sync.WaitGroup
+		wins AtomicInt
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.CompareAndSet("k", []byte("w"), ver); err == nil {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Get() != 1 {
+		t.Fatalf("exactly one writer should win, got %d", wins.Get())
+	}
+}
+
+// 写入之前开始的加载不会覆盖写入的值
+func TestCompareAndSetDuringLoad(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("cas-load", 0, GetterFunc(func(key string) ([]byte, error) {
+		entered <- struct{}{}
+		<-release
+		return []byte("old"), nil
+	}))
+	done := make(chan struct{})
+	go func() {
+		g.Get("k")
+		close(done)
+	}()
+	<-entered
+	ver, err := g.CompareAndSet("k", []byte("new"), 0)
+	if err != nil {
+		t.Fatalf("CompareAndSet failed: %v", err)
+	}
+	close(release)
+	<-done
+	if v, got, _ := g.GetWithVersion("k"); v.String() != "new" || got != ver {
+		t.Fatalf("stale load overwrote the write: %q version %d", v.String(), got)
+	}
+	if g.Stats.InvalidatedLoads.Get() != 1 {
+		t.Fatalf("stale load should be counted")
+	}
+}
+
+// 不是owner的节点上调用时返回错误 不写入缓存也不广播失效
+func TestCompareAndSetNotOwner(t *testing.T) {
+	g := NewGroup("cas-not-owner", 0, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	g.RegisterPeers(&fakePicker{owner: &fakePeer{value: "owner"}})
+	if _, err := g.CompareAndSet("k", []byte("new"), 0); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("CompareAndSet on non-owner should fail, got %v", err)
+	}
+	if g.mainCache.contains("k") || g.tombstones.latest("k", nil) != 0 {
+		t.Fatalf("non-owner CompareAndSet should not touch the cache")
+	}
+}
+
+func TestResponseVersion(t *testing.T) {
+	resp := newResponse(ByteView{s: "v", ver: 255}, nil)
+	if resp.Version != 255 || resp.Etag != "ff" {
+		t.Fatalf("version = %d, etag = %q", resp.Version, resp.Etag)
+	}
+}
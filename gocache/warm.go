@@ -0,0 +1,127 @@
+package gocache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+	缓存预热
+	节点启动后在注册到etcd之前，从数据源预先加载自己负责的key，
+	避免部署后所有节点同时冷启动，数据源承受全部请求。
+*/
+
+// 预热配置
+type WarmConfig struct {
+	// 每秒最多加载的key数量 0表示不限制
+	Rate float64
+	// 同时加载的数量
+	Concurrency int
+	// 每处理完一个key调用一次 用于报告进度
+	Progress func(WarmProgress)
+}
+
+// 预热进度
+type WarmProgress struct {
+	// 传入的key数量
+	Total int
+	// 已经处理的key数量
+	Done int
+	// 成功加载的数量
+	Loaded int
+	// 由其他节点负责或者已经在缓存中 跳过的数量
+	Skipped int
+	// 加载失败的数量
+	Failed int
+}
+
+// 从数据源加载当前节点负责的key并写入缓存
+// ctx结束时停止预热 返回已经完成的进度和ctx的错误
+func (g *Group) Warm(ctx context.Context, keys []string, cfg WarmConfig) (WarmProgress, error) {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var mu sync.Mutex
+	progress := WarmProgress{Total: len(keys)}
+	report := func(update func(*WarmProgress)) {
+		mu.Lock()
+		defer mu.Unlock()
+		update(&progress)
+		progress.Done++
+		if cfg.Progress != nil {
+			cfg.Progress(progress)
+		}
+	}
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				_, err := g.loader.Do(key, func() (interface{}, error) {
+					return g.getLocally(key)
+				})
+				report(func(p *WarmProgress) {
+					if err != nil {
+						p.Failed++
+					} else {
+						p.Loaded++
+					}
+				})
+			}
+		}()
+	}
+
+	var err error
+loop:
+	for _, key := range keys {
+		if !g.owns(key) {
+			report(func(p *WarmProgress) { p.Skipped++ })
+			continue
+		}
+		if v, ok := g.mainCache.peek(key); ok && v.fresh(time.Now()) {
+			report(func(p *WarmProgress) { p.Skipped++ })
+			continue
+		}
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				err = ctx.Err()
+				break loop
+			}
+		}
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		}
+	}
+	close(work)
+	wg.Wait()
+	return progress, err
+}
+
+// 判断当前节点是否负责该key 没有注册节点时负责所有key
+func (g *Group) owns(key string) bool {
+	switch peers := g.peers.(type) {
+	case nil:
+		return true
+	case OwnerPicker:
+		return peers.Owns(key)
+	default:
+		_, remote := peers.PickPeer(key)
+		return !remote
+	}
+}
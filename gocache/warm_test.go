@@ -0,0 +1,71 @@
+package gocache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	var loads AtomicInt
+	g := NewGroup("warm", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads.Add(1)
+			if key == "bad" {
+				return nil, ErrNotFound
+			}
+			return []byte(key), nil
+		}))
+	svr, _ := NewServer("a:1")
+	svr.newGetter = func(peer string) PeerGetter { return &fakePeer{value: peer} }
+	svr.Set("a:1", "b:1")
+	g.RegisterPeers(svr)
+
+	var keys []string
+	owned := 0
+	for i := 0; i < 20; i++ {
+		key := string(rune('a' + i))
+		keys = append(keys, key)
+		if svr.Owns(key) {
+			owned++
+		}
+	}
+	keys = append(keys, "bad")
+	if svr.Owns("bad") {
+		owned++
+	}
+	g.populateCache(keys[0], ByteView{s: "cached"})
+
+	var last WarmProgress
+	start := time.Now()
+	progress, err := g.Warm(context.Background(), keys, WarmConfig{
+		Rate:        1000,
+		Concurrency: 2,
+		Progress:    func(p WarmProgress) { last = p },
+	})
+	if err != nil || last != progress || progress.Done != len(keys) {
+		t.Fatalf("unexpected progress %+v %v", progress, err)
+	}
+	// 只加载自身负责并且不在缓存中的key
+	if int(loads.Get()) != progress.Loaded+progress.Failed || progress.Skipped != len(keys)-int(loads.Get()) {
+		t.Fatalf("unexpected progress %+v with %d loads", progress, loads.Get())
+	}
+	if svr.Owns(keys[0]) && int(loads.Get()) != owned-1 || !svr.Owns(keys[0]) && int(loads.Get()) != owned {
+		t.Fatalf("only owned keys should be loaded, got %d of %d", loads.Get(), owned)
+	}
+	if time.Since(start) < time.Duration(loads.Get()-1)*time.Millisecond {
+		t.Fatalf("warm-up should be rate limited")
+	}
+	for _, key := range keys {
+		if _, ok := g.mainCache.get(key); svr.Owns(key) && key != "bad" && !ok {
+			t.Fatalf("owned key %s should be cached", key)
+		}
+	}
+
+	// ctx结束时停止
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Warm(ctx, []string{"x", "y", "z"}, WarmConfig{Rate: 1}); err != context.Canceled {
+		t.Fatalf("canceled warm-up should return ctx error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package gocache
+
+import (
+	"errors"
+	"fmt"
+	pb "goCache/gocache/gocachepb"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+	节点之间的传输格式
+	旧版本的Server会把Response序列化后放到另一个Response的value中返回
+	新版本在Request和Response中都带上协议版本:
+	  - 新版本Server收到没有协议版本的请求时 仍然按旧格式返回
+	  - 新版本Client收到没有协议版本的响应时 按旧格式解析
+	这样滚动升级期间新旧节点之间可以互相访问
+*/
+
+// 当前的协议版本
+const wireVersion = 1
+
+// 数据源中不存在对应的key 回调函数可以返回包装了ErrNotFound的错误
+// 节点之间会通过NOT_FOUND状态传递 调用方可以用errors.Is判断
+var ErrNotFound = errors.New("gocache: key not found")
+
+// 根据版本号生成etag
+func etag(version uint64) string {
+	return strconv.FormatUint(version, 16)
+}
+
+// 根据获取的结果构造新版本的响应
+func newResponse(view ByteView, err error) *pb.Response {
+	resp := &pb.Response{WireVersion: wireVersion}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		resp.Status = pb.Status_NOT_FOUND
+		resp.Error = err.Error()
+	case err != nil:
+		resp.Status = pb.Status_ERROR
+		resp.Error = err.Error()
+	default:
+		resp.Status = pb.Status_OK
+		resp.Value = view.bytes()
+		resp.Compression = view.c
+		if !view.e.IsZero() {
+			resp.Expire = view.e.UnixNano()
+		}
+		resp.Tags = view.tags
+		if view.ver != 0 {
+			resp.Version = view.ver
+			resp.Etag = etag(view.ver)
+		}
+	}
+	return resp
+}
+
+// 将收到的响应解析到out中 兼容旧格式 非OK的状态转换为错误
+func decodeResponse(in *pb.Request, resp *pb.Response, out *pb.Response) error {
+	if resp.GetWireVersion() == 0 {
+		// 旧版本节点 value中是序列化后的Response
+		if err := proto.Unmarshal(resp.GetValue(), out); err != nil {
+			return fmt.Errorf("decoding response body:%v", err)
+		}
+		return nil
+	}
+	proto.Reset(out)
+	proto.Merge(out, resp)
+	switch out.Status {
+	case pb.Status_OK:
+		return nil
+	case pb.Status_NOT_FOUND:
+		return fmt.Errorf("%s/%s: %w", in.GetGroup(), in.GetKey(), ErrNotFound)
+	}
+	return fmt.Errorf("get %s/%s from peer: %s", in.GetGroup(), in.GetKey(), out.Error)
+}
+
+// 分块传输没有Response 数据源中不存在时通过NOT_FOUND状态码传递
+func streamStatus(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
+
+// 将分块传输收到的NOT_FOUND状态码转换为包装了ErrNotFound的错误
+func decodeStreamError(in *pb.Request, err error) error {
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("%s/%s: %w", in.GetGroup(), in.GetKey(), ErrNotFound)
+	}
+	return err
+}
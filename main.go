@@ -87,11 +87,16 @@ package main
 
 import (
 	// "flag"
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"goCache/gocache"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
 var mysql = map[string]string{
@@ -120,16 +125,58 @@ func startAPIServer(apiAddr string,cache *gocache.Group){
 			return 
 		}
 		w.Header().Set("Content-Type", "application/octet-stream") //二进制数据流媒体类型
-		w.Write(view.ByteSlice())
+		view.WriteTo(w) // 直接写入 避免复制缓存值
 	}))
 	log.Println("Gocache api is running at", apiAddr)
 	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
 }
+// 从文件中读取需要预热的key 每行一个
+func readKeys(path string) ([]string, error){
+	f, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer f.Close()
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan(){
+		if key := strings.TrimSpace(scanner.Text()); key != ""{
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+// 预热当前节点负责的key
+func warmCache(cache *gocache.Group, path string, rate float64){
+	keys, err := readKeys(path)
+	if err != nil{
+		log.Printf("Read warm-up keys from %s failed: %v", path, err)
+		return
+	}
+	log.Printf("Warming up %d keys from %s", len(keys), path)
+	progress, err := cache.Warm(context.Background(), keys, gocache.WarmConfig{
+		Rate: rate,
+		Concurrency: 4,
+		Progress: func(p gocache.WarmProgress){
+			if p.Done%1000 == 0{
+				log.Printf("Warm-up progress %d/%d", p.Done, p.Total)
+			}
+		},
+	})
+	if err != nil{
+		log.Printf("Warm-up stopped: %v", err)
+	}
+	log.Printf("Warm-up done: loaded %d, skipped %d, failed %d", progress.Loaded, progress.Skipped, progress.Failed)
+}
 // 启动etcd 
-func startCacheServerGrpcEtcd(addr string,addrs []string,cache *gocache.Group){
-	peers,_:= gocache.NewServer(addr)
+func startCacheServerGrpcEtcd(addr string,addrs []string,cache *gocache.Group,warm string,warmRate float64,opts ...gocache.ServerOption){
+	peers,_:= gocache.NewServer(addr, opts...)
 	peers.Set(addrs...)
 	cache.RegisterPeers(peers)
+	// 注册到etcd之前预热 此时其他节点还不会把请求发到当前节点
+	if warm != ""{
+		warmCache(cache, warm, warmRate)
+	}
 	log.Println("GOcache is running at ",addr)
 	err := peers.Start()
 	if err != nil{
@@ -142,6 +189,14 @@ func main() {
 	var api bool
 	flag.IntVar(&port, "port", 8001, "Gocache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	var warm string
+	var warmRate float64
+	flag.StringVar(&warm, "warm", "", "File with keys to warm up before serving, one per line")
+	flag.Float64Var(&warmRate, "warm-rate", 100, "Max keys loaded per second during warm-up, 0 for unlimited")
+	var snapshotDir string
+	var snapshotInterval time.Duration
+	flag.StringVar(&snapshotDir, "snapshot-dir", "", "Directory to restore cache snapshots from at startup and save them to")
+	flag.DurationVar(&snapshotInterval, "snapshot-interval", time.Minute, "Interval between cache snapshots, 0 to save only on stop")
 	flag.Parse()
 	// port := 8001
 	// api := true
@@ -159,7 +214,11 @@ func main() {
 	if api {
 		go startAPIServer(apiAddr, cache)
 	}
-	startCacheServerGrpcEtcd(addrMap[port], addrs, cache) //grpc版本
+	var opts []gocache.ServerOption
+	if snapshotDir != ""{
+		opts = append(opts, gocache.WithSnapshot(gocache.SnapshotConfig{Dir: snapshotDir, Interval: snapshotInterval}))
+	}
+	startCacheServerGrpcEtcd(addrMap[port], addrs, cache, warm, warmRate, opts...) //grpc版本
 
 }
 